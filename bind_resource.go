@@ -0,0 +1,81 @@
+package existingvolumebroker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+const platformKubernetes = "kubernetes"
+
+type bindingKind int
+
+const (
+	// appBinding is a binding for an app, which mounts the share through a
+	// volume mount
+	appBinding bindingKind = iota
+	// credentialsBinding is a binding for anything else, such as a service
+	// key, a credential client or a backup agent, which is handed the details
+	// of the share as credentials
+	credentialsBinding
+	// kubernetesBinding is a binding on Kubernetes, which is handed a
+	// persistent volume for the share as credentials
+	kubernetesBinding
+)
+
+// resolveBinding decides from the bind resource and the platform context what
+// a binding is for, and so the shape of its response.
+func resolveBinding(bindDetails domain.BindDetails) (bindingKind, error) {
+	if bindDetails.BindResource != nil && bindDetails.BindResource.Route != "" {
+		return 0, apiresponses.NewFailureResponse(
+			errors.New("route bindings are not supported"), http.StatusUnprocessableEntity, "unsupported-bind-resource",
+		)
+	}
+
+	platform, err := bindingPlatform(bindDetails)
+	if err != nil {
+		return 0, apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-context")
+	}
+
+	switch {
+	case strings.EqualFold(platform, platformKubernetes):
+		return kubernetesBinding, nil
+	case bindingAppGUID(bindDetails) != "":
+		return appBinding, nil
+	default:
+		return credentialsBinding, nil
+	}
+}
+
+// bindingAppGUID returns the app of a binding, which newer platforms only give
+// in the bind resource.
+func bindingAppGUID(bindDetails domain.BindDetails) string {
+	if bindDetails.AppGUID != "" {
+		return bindDetails.AppGUID
+	}
+	if bindDetails.BindResource != nil {
+		return bindDetails.BindResource.AppGuid
+	}
+	return ""
+}
+
+// bindingPlatform returns the platform named in the context of a binding, if
+// any. Contexts that are not JSON objects name no platform.
+func bindingPlatform(bindDetails domain.BindDetails) (string, error) {
+	if len(bindDetails.RawContext) == 0 {
+		return "", nil
+	}
+
+	var bindingContext interface{}
+	if err := json.Unmarshal(bindDetails.RawContext, &bindingContext); err != nil {
+		return "", err
+	}
+
+	fields, _ := bindingContext.(map[string]interface{})
+	platform, _ := fields["platform"].(string)
+	return platform, nil
+}
@@ -0,0 +1,99 @@
+package existingvolumebroker_test
+
+import (
+	"context"
+	"encoding/json"
+
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+var _ = Describe("Bind resources", func() {
+	var (
+		ctx    = context.TODO()
+		store  *localstore.MemoryStore
+		broker testBroker
+	)
+
+	BeforeEach(func() {
+		store = localstore.NewMemoryStore()
+		broker = provisionTestBroker(
+			existingvolumebroker.BrokerTypeSMB,
+			lagertest.NewTestLogger("test-broker"),
+			testConfigMask("source", "mount", "ro", "username", "password", "vers"),
+			store,
+			`{"share":"//server/share","vers":"3.0","username":"some-user","password":"some-password"}`,
+			"some-instance-id",
+		)
+	})
+
+	It("mounts the share for an app given only in the bind resource", func() {
+		binding, err := broker.bind("some-instance-id", "binding-id", domain.BindDetails{BindResource: &domain.BindResource{AppGuid: "guid"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(binding.VolumeMounts).To(HaveLen(1))
+	})
+
+	It("refuses bindings for a credential client unless service keys are enabled", func() {
+		_, err := broker.bind("some-instance-id", "binding-id", domain.BindDetails{BindResource: &domain.BindResource{CredentialClientID: "client-id"}})
+		Expect(err).To(Equal(apiresponses.ErrAppGuidNotProvided))
+	})
+
+	It("refuses route bindings", func() {
+		_, err := broker.bind("some-instance-id", "binding-id", domain.BindDetails{AppGUID: "guid", BindResource: &domain.BindResource{Route: "app.example.com"}})
+		Expect(err).To(MatchError("route bindings are not supported"))
+		Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(422))
+	})
+
+	It("treats a context that is not a JSON object as naming no platform", func() {
+		binding, err := broker.bind("some-instance-id", "binding-id", domain.BindDetails{AppGUID: "guid", RawContext: json.RawMessage(`"kubernetes"`)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(binding.VolumeMounts).To(HaveLen(1))
+	})
+
+	It("refuses a context that is not JSON", func() {
+		_, err := broker.bind("some-instance-id", "binding-id", domain.BindDetails{AppGUID: "guid", RawContext: json.RawMessage(`kubernetes`)})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+	})
+
+	Context("when service keys are enabled", func() {
+		BeforeEach(func() {
+			broker.ServiceKeys = true
+		})
+
+		DescribeTable("returns credentials to anything but an app",
+			func(bindDetails domain.BindDetails) {
+				binding, err := broker.bind("some-instance-id", "binding-id", bindDetails)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.VolumeMounts).To(BeEmpty())
+				Expect(binding.Credentials).To(HaveKeyWithValue("share", "//server/share"))
+			},
+			Entry("a credential client", domain.BindDetails{BindResource: &domain.BindResource{CredentialClientID: "client-id"}}),
+			Entry("a backup agent", domain.BindDetails{BindResource: &domain.BindResource{BackupAgent: true}}),
+		)
+
+		It("stores the bind resource and context with the binding", func() {
+			bindDetails := domain.BindDetails{
+				BindResource: &domain.BindResource{CredentialClientID: "client-id"},
+				RawContext:   json.RawMessage(`{"platform":"cloudfoundry","space_guid":"some-space-guid"}`),
+			}
+			binding, err := broker.bind("some-instance-id", "binding-id", bindDetails)
+			Expect(err).NotTo(HaveOccurred())
+
+			stored, err := store.RetrieveBindingDetails("binding-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.BindResource).To(Equal(bindDetails.BindResource))
+			Expect(stored.RawContext).To(MatchJSON(bindDetails.RawContext))
+
+			fetched, err := broker.GetBinding(ctx, "some-instance-id", "binding-id", domain.FetchBindingDetails{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fetched.Credentials).To(Equal(binding.Credentials))
+			Expect(fetched.VolumeMounts).To(BeEmpty())
+		})
+	})
+})
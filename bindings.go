@@ -0,0 +1,187 @@
+package existingvolumebroker
+
+import (
+	"sort"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+)
+
+const (
+	bindingInstanceIDKey  = "instance_id"
+	bindingPlanIDKey      = "plan_id"
+	bindingFingerprintKey = "fingerprint"
+	instanceBindingsKey   = "bindings"
+	instanceCompleteKey   = "complete"
+	appBindingsKey        = "bindings"
+)
+
+// DeprovisionPolicy decides what happens when an instance that still has
+// bindings is deprovisioned.
+type DeprovisionPolicy int
+
+const (
+	// DeprovisionPolicyRefuse fails the deprovision with a conflict.
+	DeprovisionPolicyRefuse DeprovisionPolicy = iota
+	// DeprovisionPolicyCascade deletes the bindings along with the instance.
+	DeprovisionPolicyCascade
+)
+
+// bindingInstanceID returns the service instance a binding was recorded for,
+// or an empty string for bindings created before they were recorded.
+func (b *Broker) bindingInstanceID(bindingID string) string {
+	record, err := b.records.retrieve(bindingRecord, bindingID)
+	if err != nil {
+		return ""
+	}
+
+	instanceID, _ := record[bindingInstanceIDKey].(string)
+	return instanceID
+}
+
+// boundInstance returns the service instance as it was when the binding was
+// created, so that the binding is described as it was issued however the
+// instance has been updated since. Bindings created before instances were
+// recorded with them are described from the instance as it is.
+func (b *Broker) boundInstance(bindingID string, instanceID string, instanceDetails brokerstore.ServiceInstance) brokerstore.ServiceInstance {
+	record, err := b.records.retrieve(bindingRecord, bindingID)
+	if err != nil || record[bindingInstanceIDKey] != instanceID {
+		return instanceDetails
+	}
+
+	fingerprint, ok := record[bindingFingerprintKey].(map[string]interface{})
+	if !ok {
+		return instanceDetails
+	}
+	instanceDetails.ServiceFingerPrint = fingerprint
+	instanceDetails.PlanID, _ = record[bindingPlanIDKey].(string)
+
+	return instanceDetails
+}
+
+// belongsToOtherInstance reports whether a binding was recorded for a service
+// instance other than the given one.
+func (b *Broker) belongsToOtherInstance(bindingID string, instanceID string) bool {
+	owner := b.bindingInstanceID(bindingID)
+	return owner != "" && owner != instanceID
+}
+
+// instanceBindings returns the IDs of the bindings recorded for the given
+// instance, in a stable order, and whether they are all of its bindings. They
+// are for instances provisioned since bindings have been recorded, older
+// instances may also have bindings that were never recorded.
+func (b *Broker) instanceBindings(instanceID string) ([]string, bool) {
+	record, err := b.records.retrieve(instanceBindingsRecord, instanceID)
+	if err != nil {
+		return nil, false
+	}
+
+	ids, _ := record[instanceBindingsKey].([]interface{})
+	complete, _ := record[instanceCompleteKey].(bool)
+
+	var bindingIDs []string
+	for _, id := range ids {
+		if bindingID, ok := id.(string); ok {
+			bindingIDs = append(bindingIDs, bindingID)
+		}
+	}
+	sort.Strings(bindingIDs)
+
+	return bindingIDs, complete
+}
+
+// unrecordedBindings returns the IDs of the bindings that may belong to an
+// instance provisioned before bindings were recorded. Such bindings are stored
+// without their instance, so every binding of the same service that was never
+// recorded is counted. Stores that cannot list bindings, like the CredHub
+// store, have none to offer.
+func (b *Broker) unrecordedBindings(logger lager.Logger, instanceDetails brokerstore.ServiceInstance) ([]string, error) {
+	if _, ok := b.store.(*brokerstore.CredhubStore); ok {
+		return nil, nil
+	}
+
+	bindings, err := b.store.RetrieveAllBindingDetails()
+	if err != nil {
+		logger.Error("failed-to-list-bindings", err)
+		return nil, err
+	}
+
+	var bindingIDs []string
+	for bindingID, bindDetails := range bindings {
+		if bindDetails.ServiceID == instanceDetails.ServiceID && b.bindingInstanceID(bindingID) == "" {
+			bindingIDs = append(bindingIDs, bindingID)
+		}
+	}
+	sort.Strings(bindingIDs)
+
+	return bindingIDs, nil
+}
+
+// recordBinding records a binding against its service instance, and a binding
+// for an app against the app with its mount path, so that the bindings of an
+// instance or an app can be found without listing every binding, which not all
+// stores can do. The caller holds the lock of the app.
+func (b *Broker) recordBinding(instanceID string, instanceDetails brokerstore.ServiceInstance, bindingID string, appGUID string, mountPath string) error {
+	err := b.records.create(bindingRecord, bindingID, map[string]interface{}{
+		bindingInstanceIDKey:  instanceID,
+		bindingPlanIDKey:      instanceDetails.PlanID,
+		bindingFingerprintKey: instanceDetails.ServiceFingerPrint,
+	})
+	if err != nil {
+		return err
+	}
+
+	if appGUID != "" {
+		if err := b.recordMountPath(appGUID, bindingID, mountPath); err != nil {
+			return err
+		}
+	}
+
+	bindingIDs, complete := b.instanceBindings(instanceID)
+	if containsString(bindingIDs, bindingID) {
+		return nil
+	}
+	return b.writeInstanceBindings(instanceID, append(bindingIDs, bindingID), complete)
+}
+
+// forgetBinding removes a binding from the records of its service instance.
+func (b *Broker) forgetBinding(logger lager.Logger, instanceID string, bindingID string) {
+	bindingIDs, complete := b.instanceBindings(instanceID)
+
+	var remaining []string
+	for _, id := range bindingIDs {
+		if id != bindingID {
+			remaining = append(remaining, id)
+		}
+	}
+
+	if len(remaining) == 0 && !complete {
+		b.records.forget(logger, instanceBindingsRecord, instanceID)
+	} else if err := b.writeInstanceBindings(instanceID, remaining, complete); err != nil {
+		logger.Error("failed-to-record-instance-bindings", err, lager.Data{"instanceID": instanceID})
+	}
+	b.records.forget(logger, bindingRecord, bindingID)
+}
+
+// forgetInstanceBindings removes the records of the bindings of a service
+// instance that is being deleted.
+func (b *Broker) forgetInstanceBindings(logger lager.Logger, instanceID string, bindingIDs []string) {
+	for _, bindingID := range bindingIDs {
+		b.records.forget(logger, bindingRecord, bindingID)
+	}
+	b.records.forget(logger, instanceBindingsRecord, instanceID)
+}
+
+// writeInstanceBindings records the bindings of a service instance. A complete
+// record lists every binding of the instance, and is started when the instance
+// is provisioned.
+func (b *Broker) writeInstanceBindings(instanceID string, bindingIDs []string, complete bool) error {
+	ids := make([]interface{}, len(bindingIDs))
+	for i, bindingID := range bindingIDs {
+		ids[i] = bindingID
+	}
+	return b.records.create(instanceBindingsRecord, instanceID, map[string]interface{}{
+		instanceBindingsKey: ids,
+		instanceCompleteKey: complete,
+	})
+}
@@ -0,0 +1,89 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"gopkg.in/yaml.v3"
+)
+
+type catalogFile struct {
+	Services []domain.Service `json:"services"`
+}
+
+// Parse reads a catalog in the format of the response to GET /v2/catalog, given
+// as YAML or JSON, and validates it.
+func Parse(data []byte) ([]domain.Service, error) {
+	// the catalog types only carry json tags, so the document is decoded
+	// generically first and then converted through JSON
+	var document interface{}
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&document); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse catalog: %s", err.Error())
+	}
+
+	converted, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse catalog: %s", err.Error())
+	}
+
+	catalog := catalogFile{}
+	decoder := json.NewDecoder(bytes.NewReader(converted))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog: %s", err.Error())
+	}
+
+	if err := Validate(catalog.Services); err != nil {
+		return nil, err
+	}
+	return catalog.Services, nil
+}
+
+// Validate checks that every service and plan has an ID and a name, that IDs
+// are unique across the catalog, and that every service has plans.
+func Validate(services []domain.Service) error {
+	if len(services) == 0 {
+		return errors.New("invalid catalog: no services")
+	}
+
+	serviceNames := map[string]bool{}
+	ids := map[string]bool{}
+	for i, service := range services {
+		if service.ID == "" || service.Name == "" {
+			return fmt.Errorf("invalid catalog: service %d requires an id and a name", i)
+		}
+		if ids[service.ID] {
+			return fmt.Errorf("invalid catalog: duplicate id '%s'", service.ID)
+		}
+		ids[service.ID] = true
+		if serviceNames[service.Name] {
+			return fmt.Errorf("invalid catalog: duplicate service name '%s'", service.Name)
+		}
+		serviceNames[service.Name] = true
+
+		if len(service.Plans) == 0 {
+			return fmt.Errorf("invalid catalog: service '%s' has no plans", service.Name)
+		}
+
+		planNames := map[string]bool{}
+		for j, plan := range service.Plans {
+			if plan.ID == "" || plan.Name == "" {
+				return fmt.Errorf("invalid catalog: plan %d of service '%s' requires an id and a name", j, service.Name)
+			}
+			if ids[plan.ID] {
+				return fmt.Errorf("invalid catalog: duplicate id '%s'", plan.ID)
+			}
+			ids[plan.ID] = true
+			if planNames[plan.Name] {
+				return fmt.Errorf("invalid catalog: duplicate plan name '%s' in service '%s'", plan.Name, service.Name)
+			}
+			planNames[plan.Name] = true
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package catalog_test
+
+import (
+	"code.cloudfoundry.org/existingvolumebroker/catalog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+)
+
+var _ = Describe("Catalog", func() {
+	Context("Parse", func() {
+		It("parses a YAML catalog", func() {
+			services, err := catalog.Parse([]byte(`
+services:
+- id: nfs-service-id
+  name: nfs
+  description: Existing NFSv3 volumes
+  bindable: true
+  tags: [nfs]
+  requires: [volume_mount]
+  plans:
+  - id: nfs-existing-plan-id
+    name: Existing
+    description: A preexisting filesystem
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(services).To(Equal([]domain.Service{{
+				ID:          "nfs-service-id",
+				Name:        "nfs",
+				Description: "Existing NFSv3 volumes",
+				Bindable:    true,
+				Tags:        []string{"nfs"},
+				Requires:    []domain.RequiredPermission{"volume_mount"},
+				Plans: []domain.ServicePlan{{
+					ID:          "nfs-existing-plan-id",
+					Name:        "Existing",
+					Description: "A preexisting filesystem",
+				}},
+			}}))
+		})
+
+		It("parses a JSON catalog", func() {
+			services, err := catalog.Parse([]byte(`{"services":[{"id":"smb-service-id","name":"smb","plans":[{"id":"smb-plan-id","name":"Existing","free":true}]}]}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(services).To(HaveLen(1))
+			Expect(services[0].Plans[0].ID).To(Equal("smb-plan-id"))
+			Expect(*services[0].Plans[0].Free).To(BeTrue())
+		})
+
+		It("rejects malformed catalogs", func() {
+			_, err := catalog.Parse([]byte("services: [\n"))
+			Expect(err).To(MatchError(ContainSubstring("failed to parse catalog")))
+		})
+
+		It("rejects unknown fields", func() {
+			_, err := catalog.Parse([]byte(`{"services":[{"id":"smb-service-id","name":"smb","plan":[]}]}`))
+			Expect(err).To(MatchError(ContainSubstring(`unknown field "plan"`)))
+		})
+
+		It("rejects an empty catalog", func() {
+			_, err := catalog.Parse([]byte(""))
+			Expect(err).To(MatchError("invalid catalog: no services"))
+		})
+	})
+
+	DescribeTable("Validate",
+		func(services []domain.Service, message string) {
+			Expect(catalog.Validate(services)).To(MatchError(message))
+		},
+		Entry("a service without an id", []domain.Service{{Name: "nfs"}}, "invalid catalog: service 0 requires an id and a name"),
+		Entry("a service without plans", []domain.Service{{ID: "nfs-id", Name: "nfs"}}, "invalid catalog: service 'nfs' has no plans"),
+		Entry("a plan without a name", []domain.Service{
+			{ID: "nfs-id", Name: "nfs", Plans: []domain.ServicePlan{{ID: "plan-id"}}},
+		}, "invalid catalog: plan 0 of service 'nfs' requires an id and a name"),
+		Entry("duplicate service ids", []domain.Service{
+			{ID: "nfs-id", Name: "nfs", Plans: []domain.ServicePlan{{ID: "plan-id", Name: "Existing"}}},
+			{ID: "nfs-id", Name: "nfs-experimental", Plans: []domain.ServicePlan{{ID: "other-plan-id", Name: "Existing"}}},
+		}, "invalid catalog: duplicate id 'nfs-id'"),
+		Entry("duplicate service names", []domain.Service{
+			{ID: "nfs-id", Name: "nfs", Plans: []domain.ServicePlan{{ID: "plan-id", Name: "Existing"}}},
+			{ID: "other-nfs-id", Name: "nfs", Plans: []domain.ServicePlan{{ID: "other-plan-id", Name: "Existing"}}},
+		}, "invalid catalog: duplicate service name 'nfs'"),
+		Entry("plan ids shared across services", []domain.Service{
+			{ID: "nfs-id", Name: "nfs", Plans: []domain.ServicePlan{{ID: "plan-id", Name: "Existing"}}},
+			{ID: "smb-id", Name: "smb", Plans: []domain.ServicePlan{{ID: "plan-id", Name: "Existing"}}},
+		}, "invalid catalog: duplicate id 'plan-id'"),
+		Entry("duplicate plan names", []domain.Service{
+			{ID: "nfs-id", Name: "nfs", Plans: []domain.ServicePlan{{ID: "plan-id", Name: "Existing"}, {ID: "other-plan-id", Name: "Existing"}}},
+		}, "invalid catalog: duplicate plan name 'Existing' in service 'nfs'"),
+	)
+})
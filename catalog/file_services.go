@@ -0,0 +1,136 @@
+package catalog
+
+import (
+	"bytes"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/tedsuo/ifrit"
+)
+
+// FileServices serves the catalog of a broker from a file, which can be
+// reloaded while the broker runs. A catalog file that fails to load leaves the
+// previous catalog in place.
+type FileServices struct {
+	logger lager.Logger
+	path   string
+
+	mutex    sync.RWMutex
+	services []domain.Service
+	// data is the contents of the catalog file last loaded, or attempted to be
+	// loaded, so that unchanged files are not parsed again
+	data []byte
+}
+
+// NewFileServices loads the catalog from the file at path.
+func NewFileServices(logger lager.Logger, path string) (*FileServices, error) {
+	s := &FileServices{
+		logger: logger.Session("catalog", lager.Data{"path": path}),
+		path:   path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	s.services = services
+	s.data = data
+	return s, nil
+}
+
+func (s *FileServices) List() []domain.Service {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.services
+}
+
+// Reload loads the catalog file again, if its contents have changed.
+func (s *FileServices) Reload() error {
+	logger := s.logger.Session("reload")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		logger.Error("failed-to-read-catalog-file", err)
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if bytes.Equal(data, s.data) {
+		return nil
+	}
+	s.data = data
+
+	services, err := Parse(data)
+	if err != nil {
+		logger.Error("failed-to-load-catalog", err)
+		return err
+	}
+
+	s.services = services
+	logger.Info("catalog-reloaded", lager.Data{"services": len(services)})
+	return nil
+}
+
+// Reloader returns a runner that reloads the catalog whenever the process
+// receives SIGHUP and, given a positive poll interval, whenever the catalog
+// file changes.
+func (s *FileServices) Reloader(clock clock.Clock, pollInterval time.Duration) ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+
+		var poll <-chan time.Time
+		if pollInterval > 0 {
+			ticker := clock.NewTicker(pollInterval)
+			defer ticker.Stop()
+			poll = ticker.C()
+		}
+
+		close(ready)
+
+		for {
+			select {
+			case <-signals:
+				return nil
+			case <-hup:
+				_ = s.Reload()
+			case <-poll:
+				if s.changed() {
+					_ = s.Reload()
+				}
+			}
+		}
+	})
+}
+
+// changed reports whether the catalog file can be read and differs from the
+// contents last loaded.
+func (s *FileServices) changed() bool {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return false
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return !bytes.Equal(data, s.data)
+}
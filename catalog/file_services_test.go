@@ -0,0 +1,117 @@
+package catalog_test
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/existingvolumebroker/catalog"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("FileServices", func() {
+	var (
+		logger      *lagertest.TestLogger
+		catalogPath string
+		services    *catalog.FileServices
+	)
+
+	writeCatalog := func(planName string) {
+		Expect(os.WriteFile(catalogPath, []byte(`
+services:
+- id: nfs-service-id
+  name: nfs
+  plans:
+  - id: nfs-plan-id
+    name: `+planName+`
+`), 0600)).To(Succeed())
+	}
+
+	planNames := func() []string {
+		names := []string{}
+		for _, plan := range services.List()[0].Plans {
+			names = append(names, plan.Name)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("file-services")
+		catalogPath = filepath.Join(GinkgoT().TempDir(), "catalog.yml")
+		writeCatalog("Existing")
+
+		var err error
+		services, err = catalog.NewFileServices(logger, catalogPath)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("lists the services of the catalog file", func() {
+		Expect(services.List()).To(Equal([]domain.Service{{
+			ID:    "nfs-service-id",
+			Name:  "nfs",
+			Plans: []domain.ServicePlan{{ID: "nfs-plan-id", Name: "Existing"}},
+		}}))
+	})
+
+	It("fails to load a missing or invalid catalog file", func() {
+		_, err := catalog.NewFileServices(logger, filepath.Join(GinkgoT().TempDir(), "missing.yml"))
+		Expect(err).To(HaveOccurred())
+
+		Expect(os.WriteFile(catalogPath, []byte("services: []\n"), 0600)).To(Succeed())
+		_, err = catalog.NewFileServices(logger, catalogPath)
+		Expect(err).To(MatchError("invalid catalog: no services"))
+	})
+
+	Context("Reload", func() {
+		It("loads the changed catalog file", func() {
+			writeCatalog("Renamed")
+			Expect(services.Reload()).To(Succeed())
+			Expect(planNames()).To(Equal([]string{"Renamed"}))
+			Expect(logger.Buffer()).To(gbytes.Say("catalog-reloaded"))
+		})
+
+		It("keeps the previous catalog when the file is invalid", func() {
+			Expect(os.WriteFile(catalogPath, []byte("services: [\n"), 0600)).To(Succeed())
+			Expect(services.Reload()).To(MatchError(ContainSubstring("failed to parse catalog")))
+			Expect(logger.Buffer()).To(gbytes.Say("failed-to-load-catalog"))
+			Expect(planNames()).To(Equal([]string{"Existing"}))
+		})
+
+		It("keeps the previous catalog when the file is missing", func() {
+			Expect(os.Remove(catalogPath)).To(Succeed())
+			Expect(services.Reload()).To(HaveOccurred())
+			Expect(planNames()).To(Equal([]string{"Existing"}))
+		})
+	})
+
+	Context("Reloader", func() {
+		var process ifrit.Process
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		It("reloads the catalog on SIGHUP", func() {
+			process = ifrit.Invoke(services.Reloader(clock.NewClock(), 0))
+
+			writeCatalog("Renamed")
+			Expect(syscall.Kill(os.Getpid(), syscall.SIGHUP)).To(Succeed())
+			Eventually(planNames).Should(Equal([]string{"Renamed"}))
+		})
+
+		It("reloads the catalog when the file changes", func() {
+			process = ifrit.Invoke(services.Reloader(clock.NewClock(), 10*time.Millisecond))
+
+			writeCatalog("Renamed")
+			Eventually(planNames).Should(Equal([]string{"Renamed"}))
+		})
+	})
+})
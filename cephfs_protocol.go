@@ -0,0 +1,111 @@
+package existingvolumebroker
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	vmo "code.cloudfoundry.org/volume-mount-options"
+)
+
+const (
+	CEPH_CLIENT_NAME_KEY   = "name"
+	CEPH_CLIENT_SECRET_KEY = "secret"
+)
+
+var cephClientName = regexp.MustCompile(`^[A-Za-z0-9_.@-]+$`)
+
+// CephFSProtocol binds CephFS subvolumes to the cephdriver. The client name and
+// secret the subvolume is mounted with are given when binding.
+type CephFSProtocol struct{}
+
+// ParseShare parses a comma separated list of monitors, each with an optional
+// port, followed by the path of the subvolume, as in
+// "mon1:6789,mon2:6789:/volumes/group/subvolume".
+func (CephFSProtocol) ParseShare(share string) (Share, error) {
+	if err := rejectURL(share); err != nil {
+		return Share{}, err
+	}
+
+	monitors, sharePath, ok := strings.Cut(share, ":/")
+	if !ok {
+		return Share{}, shareSyntaxError("missing path after monitors, expected monitor[:port][,monitor[:port]...]:/path")
+	}
+
+	var servers []Server
+	var canonicalMonitors []string
+	for _, monitor := range strings.Split(monitors, ",") {
+		server, err := parseServer(monitor, true)
+		if err != nil {
+			return Share{}, err
+		}
+		servers = append(servers, server)
+		canonicalMonitors = append(canonicalMonitors, server.String())
+	}
+
+	cleanedPath, err := cleanPath("/" + sharePath)
+	if err != nil {
+		return Share{}, err
+	}
+
+	return Share{
+		Servers:   servers,
+		Path:      cleanedPath,
+		Canonical: strings.Join(canonicalMonitors, ",") + ":" + cleanedPath,
+	}, nil
+}
+
+func (CephFSProtocol) Source(share string) string {
+	return share
+}
+
+func (CephFSProtocol) DriverName() string {
+	return "cephdriver"
+}
+
+// MountConfig requires the client credentials, which cannot be mandatory in the
+// mask as the mask also validates instance parameters on update.
+func (CephFSProtocol) MountConfig(mountOpts map[string]interface{}) (map[string]interface{}, error) {
+	var missing []string
+	for _, key := range []string{CEPH_CLIENT_NAME_KEY, CEPH_CLIENT_SECRET_KEY} {
+		if v, ok := mountOpts[key].(string); !ok || v == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("bind configuration is missing the following ceph client credentials: ['%s']", strings.Join(missing, "', '"))
+	}
+
+	return mountOpts, nil
+}
+
+// Mask allows the client credentials and validates their format.
+func (CephFSProtocol) Mask(mask vmo.MountOptsMask) vmo.MountOptsMask {
+	allowed := append([]string{}, mask.Allowed...)
+	for _, option := range []string{CEPH_CLIENT_NAME_KEY, CEPH_CLIENT_SECRET_KEY} {
+		if !containsString(allowed, option) {
+			allowed = append(allowed, option)
+		}
+	}
+	mask.Allowed = allowed
+
+	validations := append([]vmo.UserOptsValidation{}, mask.ValidationFunc...)
+	mask.ValidationFunc = append(validations, vmo.UserOptsValidationFunc(validateCephFSOption))
+
+	return mask
+}
+
+func validateCephFSOption(key string, value string) error {
+	switch key {
+	case CEPH_CLIENT_NAME_KEY:
+		if !cephClientName.MatchString(value) {
+			return fmt.Errorf("%s is not a valid ceph client name", key)
+		}
+	case CEPH_CLIENT_SECRET_KEY:
+		if _, err := base64.StdEncoding.DecodeString(value); err != nil || value == "" {
+			return fmt.Errorf("%s is not a base64 encoded ceph key", key)
+		}
+	}
+	return nil
+}
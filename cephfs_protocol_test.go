@@ -0,0 +1,111 @@
+package existingvolumebroker_test
+
+import (
+	"context"
+	"encoding/json"
+
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/fakes"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	vmo "code.cloudfoundry.org/volume-mount-options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+var _ = Describe("CephFSProtocol", func() {
+	protocol := existingvolumebroker.CephFSProtocol{}
+
+	It("mounts with the cephdriver from the share", func() {
+		Expect(protocol.DriverName()).To(Equal("cephdriver"))
+		Expect(protocol.Source("mon1:6789:/subvolume")).To(Equal("mon1:6789:/subvolume"))
+	})
+
+	Context("when the broker type is CephFS", func() {
+		var (
+			ctx    context.Context
+			logger *lagertest.TestLogger
+			broker *existingvolumebroker.Broker
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			logger = lagertest.NewTestLogger("test-broker")
+
+			configMask, err := vmo.NewMountOptsMask(
+				[]string{"source", "mount", "readonly"},
+				map[string]interface{}{},
+				map[string]string{"share": "source"},
+				[]string{},
+				[]string{"source"},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			broker = existingvolumebroker.New(
+				existingvolumebroker.BrokerTypeCephFS,
+				logger,
+				&fakes.FakeServices{},
+				&os_fake.FakeOs{},
+				nil,
+				localstore.NewMemoryStore(),
+				configMask,
+			)
+
+			_, err = broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+				RawParameters: json.RawMessage(`{"share":"mon1:6789,mon2:6789:/volumes/group/subvolume"}`),
+			}, false)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		bind := func(params string) (domain.Binding, error) {
+			return broker.Bind(ctx, "some-instance-id", "binding-id", domain.BindDetails{
+				AppGUID:       "guid",
+				RawParameters: json.RawMessage(params),
+			}, false)
+		}
+
+		It("binds with the client credentials", func() {
+			binding, err := bind(`{"name":"app-client","secret":"QVFEbWFueWJ5dGVz"}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(binding.VolumeMounts[0].Driver).To(Equal("cephdriver"))
+			Expect(binding.VolumeMounts[0].DeviceType).To(Equal("shared"))
+			Expect(binding.VolumeMounts[0].Device.MountConfig).To(Equal(map[string]interface{}{
+				"source": "mon1:6789,mon2:6789:/volumes/group/subvolume",
+				"name":   "app-client",
+				"secret": "QVFEbWFueWJ5dGVz",
+			}))
+		})
+
+		It("requires the client credentials", func() {
+			_, err := bind(`{"name":"app-client"}`)
+			Expect(err).To(MatchError("bind configuration is missing the following ceph client credentials: ['secret']"))
+			Expect(err).To(BeAssignableToTypeOf(&apiresponses.FailureResponse{}))
+			Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+		})
+
+		It("validates the client credentials through the mask", func() {
+			_, err := bind(`{"name":"app client","secret":"not base64!"}`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("name is not a valid ceph client name"))
+			Expect(err.Error()).To(ContainSubstring("secret is not a base64 encoded ceph key"))
+			Expect(err.Error()).NotTo(ContainSubstring("not base64!"))
+		})
+
+		It("does not reveal the secret in logs or when fetching the binding", func() {
+			_, err := bind(`{"name":"app-client","secret":"QVFEbWFueWJ5dGVz"}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			binding, err := broker.GetBinding(ctx, "some-instance-id", "binding-id", domain.FetchBindingDetails{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(binding.Parameters).To(Equal(map[string]interface{}{"name": "app-client"}))
+
+			Expect(logger.Buffer()).To(gbytes.Say("volume-service-binding"))
+			Expect(logger.Buffer().Contents()).NotTo(ContainSubstring("QVFEbWFueWJ5dGVz"))
+		})
+	})
+})
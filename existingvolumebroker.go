@@ -9,8 +9,9 @@ import (
 	"fmt"
 	"net/http"
 	"path"
-	"regexp"
-	"sync"
+	"reflect"
+	"sort"
+	"strings"
 
 	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/goshims/osshim"
@@ -26,31 +27,70 @@ const (
 	DEFAULT_CONTAINER_PATH = "/var/vcap/data"
 	SHARE_KEY              = "share"
 	SOURCE_KEY             = "source"
+	SUBPATH_KEY            = "subpath"
 	VERSION_KEY            = "version"
 )
 
-type lock interface {
-	Lock()
-	Unlock()
-}
+var secretParameterKeys = []string{"password", CEPH_CLIENT_SECRET_KEY}
 
 type BrokerType int
 
 const (
 	BrokerTypeNFS BrokerType = iota
 	BrokerTypeSMB
+	BrokerTypeNFSv4
+	BrokerTypeCephFS
 )
 
 type Broker struct {
-	brokerType              BrokerType
+	protocol                Protocol
 	logger                  lager.Logger
 	os                      osshim.Os
-	mutex                   lock
+	locks                   *keyedLock
+	appLocks                *keyedLock
 	clock                   clock.Clock
 	store                   brokerstore.Store
+	records                 records
 	services                Services
 	configMask              vmo.MountOptsMask
+	operations              *operationTracker
 	DisallowedBindOverrides []string
+	ImmutableUpdateKeys     []string
+	// AsyncOperations makes Provision and Bind complete in the background when
+	// the platform accepts incomplete operations.
+	AsyncOperations bool
+	// DeprovisionPolicy decides what happens to the bindings of a service
+	// instance that is deprovisioned.
+	DeprovisionPolicy DeprovisionPolicy
+	// SensitiveKeys are the parameter names whose values are masked wherever
+	// they appear in the data the broker logs, and which are left out of the
+	// parameters and credentials it returns. The secrets of the built-in
+	// protocols are always sensitive.
+	SensitiveKeys []string
+	// SharePolicy, when set, restricts the shares instances can be provisioned
+	// or updated for.
+	SharePolicy *SharePolicy
+	// ScopedSharePolicies, when set, further restrict the shares of instances
+	// by the organization and space they belong to.
+	ScopedSharePolicies *ScopedSharePolicies
+	// PlanConfigMasks are the mount option masks of particular plans, keyed by
+	// plan ID. Instances of other plans use the mask the broker was created
+	// with.
+	PlanConfigMasks map[string]vmo.MountOptsMask
+	// ReadOnlyPlans are the IDs of plans whose instances can only be bound
+	// read-only.
+	ReadOnlyPlans []string
+	// GenerateSchemas makes Services describe the parameters of each plan
+	// with JSON schemas generated from its config mask, unless the catalog
+	// gives schemas for the plan.
+	GenerateSchemas bool
+	// ServiceKeys allows bindings that are not for an app, such as service
+	// keys and backup agents. They get the details of the share as credentials
+	// instead of a volume mount.
+	ServiceKeys bool
+	// DisallowedMountPaths are the directories bindings cannot be mounted at
+	// or within.
+	DisallowedMountPaths []string
 }
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
@@ -68,38 +108,58 @@ func New(
 	store brokerstore.Store,
 	configMask vmo.MountOptsMask,
 ) *Broker {
+	return NewWithProtocol(protocolFor(brokerType), logger, services, os, clock, store, configMask)
+}
+
+// NewWithProtocol returns a broker for shares of the given protocol, which
+// need not be one of the built-in ones.
+func NewWithProtocol(
+	protocol Protocol,
+	logger lager.Logger,
+	services Services,
+	os osshim.Os,
+	clock clock.Clock,
+	store brokerstore.Store,
+	configMask vmo.MountOptsMask,
+) *Broker {
+	if masker, ok := protocol.(MountOptionsMasker); ok {
+		configMask = masker.Mask(configMask)
+	}
+
 	theBroker := Broker{
-		brokerType:              brokerType,
-		logger:                  logger,
+		protocol:                protocol,
 		os:                      os,
-		mutex:                   &sync.Mutex{},
+		locks:                   newKeyedLock(),
+		appLocks:                newKeyedLock(),
 		clock:                   clock,
 		store:                   store,
 		services:                services,
 		configMask:              configMask,
+		records:                 records{store: store},
+		operations:              newOperationTracker(records{store: store}),
 		DisallowedBindOverrides: []string{SHARE_KEY, SOURCE_KEY},
+		ImmutableUpdateKeys:     []string{SHARE_KEY},
+		SensitiveKeys:           []string{"password", "username", "domain", CEPH_CLIENT_SECRET_KEY},
+		DisallowedMountPaths:    append([]string{}, defaultDisallowedMountPaths...),
 	}
+	theBroker.logger = newRedactingLogger(logger, theBroker.sensitiveKeys)
 
 	return &theBroker
 }
 
-func (b *Broker) isNFSBroker() bool {
-	return b.brokerType == BrokerTypeNFS
-}
-
-func (b *Broker) isSMBBroker() bool {
-	return b.brokerType == BrokerTypeSMB
-}
-
 func (b *Broker) Services(_ context.Context) ([]domain.Service, error) {
 	logger := b.logger.Session("services")
 	logger.Info("start")
 	defer logger.Info("end")
 
-	return b.services.List(), nil
+	services := b.services.List()
+	if b.GenerateSchemas {
+		services = b.withSchemas(services)
+	}
+	return services, nil
 }
 
-func (b *Broker) Provision(context context.Context, instanceID string, details domain.ProvisionDetails, _ bool) (_ domain.ProvisionedServiceSpec, e error) {
+func (b *Broker) Provision(ctx context.Context, instanceID string, details domain.ProvisionDetails, asyncAllowed bool) (_ domain.ProvisionedServiceSpec, e error) {
 	logger := b.logger.Session("provision").WithData(lager.Data{"instanceID": instanceID, "details": details})
 	logger.Info("start")
 	defer logger.Info("end")
@@ -121,17 +181,27 @@ func (b *Broker) Provision(context context.Context, instanceID string, details d
 		return domain.ProvisionedServiceSpec{}, errors.New("create configuration contains the following invalid option: ['" + SOURCE_KEY + "']")
 	}
 
-	if b.isNFSBroker() {
-		re := regexp.MustCompile("^[^/]+:/")
-		match := re.MatchString(share)
+	if err := b.validateInstanceMountPath(logger, configuration); err != nil {
+		return domain.ProvisionedServiceSpec{}, err
+	}
 
-		if match {
-			return domain.ProvisionedServiceSpec{}, errors.New("syntax error for share: no colon allowed after server")
-		}
+	if err := refuseReservedIDs(instanceID); err != nil {
+		return domain.ProvisionedServiceSpec{}, err
+	}
+
+	parsedShare, err := b.protocol.ParseShare(share)
+	if err != nil {
+		return domain.ProvisionedServiceSpec{}, err
+	}
+	if err := b.evaluateSharePolicy(logger, parsedShare, details.OrganizationGUID, details.SpaceGUID); err != nil {
+		return domain.ProvisionedServiceSpec{}, err
 	}
+	configuration[SHARE_KEY] = parsedShare.Canonical
 
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
+	if err := b.locks.Lock(ctx, instanceID); err != nil {
+		return domain.ProvisionedServiceSpec{}, abandon(logger, err)
+	}
+	defer b.locks.Unlock(instanceID)
 	defer func() {
 		out := b.store.Save(logger)
 		if e == nil {
@@ -139,6 +209,16 @@ func (b *Broker) Provision(context context.Context, instanceID string, details d
 		}
 	}()
 
+	// an instance stored before shares were normalized keeps the spelling of
+	// its share when provisioned again for the same share
+	if existing, err := b.retrieveInstance(instanceID); err == nil {
+		if fingerprint, err := getFingerprint(existing.ServiceFingerPrint); err == nil {
+			if share, ok := b.storedShareSpelling(fingerprint, parsedShare.Canonical); ok {
+				configuration[SHARE_KEY] = share
+			}
+		}
+	}
+
 	instanceDetails := brokerstore.ServiceInstance{
 		ServiceID:          details.ServiceID,
 		PlanID:             details.PlanID,
@@ -147,27 +227,115 @@ func (b *Broker) Provision(context context.Context, instanceID string, details d
 		ServiceFingerPrint: configuration,
 	}
 
+	if b.operationInProgress(instanceOperationRecord, instanceID, provisionOperation) {
+		if !asyncAllowed {
+			return domain.ProvisionedServiceSpec{}, apiresponses.ErrConcurrentInstanceAccess
+		}
+		logger.Info("provision-already-in-progress")
+		return domain.ProvisionedServiceSpec{IsAsync: true, OperationData: provisionOperation}, nil
+	}
+
 	if b.instanceConflicts(instanceDetails, instanceID) {
 		return domain.ProvisionedServiceSpec{}, apiresponses.ErrInstanceAlreadyExists
 	}
 
+	if err := ctx.Err(); err != nil {
+		return domain.ProvisionedServiceSpec{}, abandon(logger, err)
+	}
+
+	if b.AsyncOperations && asyncAllowed {
+		err = b.operations.start(instanceOperationRecord, instanceID, provisionOperation)
+		if err != nil {
+			return domain.ProvisionedServiceSpec{}, fmt.Errorf("failed to store operation state: %s", err.Error())
+		}
+
+		go b.runAsync(logger, instanceID, instanceOperationRecord, instanceID, provisionOperation, func() error {
+			return b.createInstance(logger, instanceID, instanceDetails)
+		})
+
+		return domain.ProvisionedServiceSpec{IsAsync: true, OperationData: provisionOperation}, nil
+	}
+
+	if err := b.createInstance(logger, instanceID, instanceDetails); err != nil {
+		return domain.ProvisionedServiceSpec{}, err
+	}
+
+	// an earlier asynchronous provision that failed is superseded
+	b.operations.forget(logger, instanceOperationRecord, instanceID)
+
+	return domain.ProvisionedServiceSpec{IsAsync: false}, nil
+}
+
+func (b *Broker) createInstance(logger lager.Logger, instanceID string, instanceDetails brokerstore.ServiceInstance) error {
+	// the bindings of a new instance are recorded from the start, those of an
+	// instance provisioned again are left as they are
+	_, err := b.store.RetrieveInstanceDetails(instanceID)
+	isNew := err != nil
+	if isNew {
+		if err := b.writeInstanceBindings(instanceID, nil, true); err != nil {
+			return fmt.Errorf("failed to record instance bindings: %s", err.Error())
+		}
+	}
+
 	err = b.store.CreateInstanceDetails(instanceID, instanceDetails)
 	if err != nil {
-		return domain.ProvisionedServiceSpec{}, fmt.Errorf("failed to store instance details: %s", err.Error())
+		if isNew {
+			b.records.forget(logger, instanceBindingsRecord, instanceID)
+		}
+		return fmt.Errorf("failed to store instance details: %s", err.Error())
 	}
 
 	logger.Info("service-instance-created", lager.Data{"instanceDetails": instanceDetails})
 
-	return domain.ProvisionedServiceSpec{IsAsync: false}, nil
+	return nil
+}
+
+// operationInProgress reports whether an asynchronous operation is still
+// running. Only brokers with asynchronous operations start them.
+func (b *Broker) operationInProgress(kind string, id string, operation string) bool {
+	return b.AsyncOperations && b.operations.inProgress(kind, id, operation)
+}
+
+// runAsync performs work in the background on behalf of an asynchronous
+// operation and records its outcome so that it can be polled. The work runs
+// under the lock of the service instance it belongs to.
+func (b *Broker) runAsync(logger lager.Logger, instanceID string, kind string, id string, operation string, work func() error) {
+	logger = logger.Session("async-" + operation)
+	logger.Info("start")
+	defer logger.Info("end")
+
+	// the request that started this operation has already been answered, so
+	// its context cannot be used to give up on the lock
+	_ = b.locks.Lock(context.Background(), instanceID)
+	defer b.locks.Unlock(instanceID)
+
+	err := work()
+	if err == nil {
+		err = b.store.Save(logger)
+	}
+	if err != nil {
+		logger.Error("operation-failed", err)
+	}
+
+	if err := b.operations.finish(kind, id, operation, err); err != nil {
+		logger.Error("failed-to-store-operation-state", err)
+		return
+	}
+
+	if err := b.store.Save(logger); err != nil {
+		logger.Error("failed-to-save-operation-state", err)
+	}
 }
 
-func (b *Broker) Deprovision(context context.Context, instanceID string, details domain.DeprovisionDetails, _ bool) (_ domain.DeprovisionServiceSpec, e error) {
+func (b *Broker) Deprovision(ctx context.Context, instanceID string, details domain.DeprovisionDetails, _ bool) (_ domain.DeprovisionServiceSpec, e error) {
 	logger := b.logger.Session("deprovision")
 	logger.Info("start")
 	defer logger.Info("end")
 
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
+	if err := b.locks.Lock(ctx, instanceID); err != nil {
+		return domain.DeprovisionServiceSpec{}, abandon(logger, err)
+	}
+	defer b.locks.Unlock(instanceID)
 	defer func() {
 		out := b.store.Save(logger)
 		if e == nil {
@@ -175,26 +343,79 @@ func (b *Broker) Deprovision(context context.Context, instanceID string, details
 		}
 	}()
 
-	_, err := b.store.RetrieveInstanceDetails(instanceID)
+	instanceDetails, err := b.retrieveInstance(instanceID)
 	if err != nil {
+		if b.operationInProgress(instanceOperationRecord, instanceID, provisionOperation) {
+			return domain.DeprovisionServiceSpec{}, apiresponses.ErrConcurrentInstanceAccess
+		}
+		// a failed asynchronous provision leaves only its operation behind
+		b.operations.forget(logger, instanceOperationRecord, instanceID)
 		return domain.DeprovisionServiceSpec{}, apiresponses.ErrInstanceDoesNotExist
 	}
 
+	bindingIDs, complete := b.instanceBindings(instanceID)
+	for _, bindingID := range bindingIDs {
+		if b.operationInProgress(bindingOperationRecord, bindingID, bindOperation) {
+			return domain.DeprovisionServiceSpec{}, apiresponses.ErrConcurrentInstanceAccess
+		}
+	}
+
+	if !complete {
+		// bindings that may belong to the instance cannot be cascaded to, as
+		// they may as well belong to another
+		unrecordedIDs, err := b.unrecordedBindings(logger, instanceDetails)
+		if err != nil {
+			return domain.DeprovisionServiceSpec{}, err
+		}
+		if len(unrecordedIDs) > 0 {
+			err := fmt.Errorf("service instance may still have bindings: ['%s']", strings.Join(unrecordedIDs, "', '"))
+			logger.Error("err-instance-may-have-bindings", err)
+			return domain.DeprovisionServiceSpec{}, apiresponses.NewFailureResponse(err, http.StatusConflict, "instance-has-bindings")
+		}
+	}
+
+	if len(bindingIDs) > 0 && b.DeprovisionPolicy != DeprovisionPolicyCascade {
+		err := fmt.Errorf("service instance still has bindings: ['%s']", strings.Join(bindingIDs, "', '"))
+		logger.Error("err-instance-has-bindings", err)
+		return domain.DeprovisionServiceSpec{}, apiresponses.NewFailureResponse(err, http.StatusConflict, "instance-has-bindings")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return domain.DeprovisionServiceSpec{}, abandon(logger, err)
+	}
+
+	for _, bindingID := range bindingIDs {
+		bindDetails, retrieveErr := b.store.RetrieveBindingDetails(bindingID)
+		if err := b.store.DeleteBindingDetails(bindingID); err != nil {
+			return domain.DeprovisionServiceSpec{}, err
+		}
+		if retrieveErr == nil {
+			b.forgetMountPath(logger, bindingID, bindDetails)
+		}
+		b.operations.forget(logger, bindingOperationRecord, bindingID)
+		logger.Info("service-binding-deleted", lager.Data{"bindingID": bindingID})
+	}
+
 	err = b.store.DeleteInstanceDetails(instanceID)
 	if err != nil {
 		return domain.DeprovisionServiceSpec{}, err
 	}
 
+	b.forgetInstanceBindings(logger, instanceID, bindingIDs)
+	b.operations.forget(logger, instanceOperationRecord, instanceID)
+
 	return domain.DeprovisionServiceSpec{IsAsync: false, OperationData: "deprovision"}, nil
 }
 
-func (b *Broker) Bind(context context.Context, instanceID string, bindingID string, bindDetails domain.BindDetails, _ bool) (_ domain.Binding, e error) {
+func (b *Broker) Bind(ctx context.Context, instanceID string, bindingID string, bindDetails domain.BindDetails, asyncAllowed bool) (_ domain.Binding, e error) {
 	logger := b.logger.Session("bind")
 	logger.Info("start", lager.Data{"bindingID": bindingID, "details": bindDetails})
 	defer logger.Info("end")
 
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
+	if err := b.locks.Lock(ctx, instanceID); err != nil {
+		return domain.Binding{}, abandon(logger, err)
+	}
+	defer b.locks.Unlock(instanceID)
 	defer func() {
 		out := b.store.Save(logger)
 		if e == nil {
@@ -202,25 +423,147 @@ func (b *Broker) Bind(context context.Context, instanceID string, bindingID stri
 		}
 	}()
 
+	if err := refuseReservedIDs(bindingID); err != nil {
+		return domain.Binding{}, err
+	}
+
 	logger.Info("starting-broker-bind")
-	instanceDetails, err := b.store.RetrieveInstanceDetails(instanceID)
+	instanceDetails, err := b.retrieveInstance(instanceID)
 	if err != nil {
 		return domain.Binding{}, apiresponses.ErrInstanceDoesNotExist
 	}
 
-	if bindDetails.AppGUID == "" {
+	if b.operationInProgress(bindingOperationRecord, bindingID, bindOperation) {
+		if !asyncAllowed {
+			return domain.Binding{}, apiresponses.ErrConcurrentInstanceAccess
+		}
+		logger.Info("bind-already-in-progress")
+		return domain.Binding{IsAsync: true, OperationData: bindOperation}, nil
+	}
+
+	// a repeated binding is given what it was given the first time
+	instanceDetails = b.boundInstance(bindingID, instanceID, instanceDetails)
+
+	kind, err := resolveBinding(bindDetails)
+	if err != nil {
+		logger.Error("err-resolving-binding", err)
+		return domain.Binding{}, err
+	}
+	if kind == credentialsBinding && !b.ServiceKeys {
 		return domain.Binding{}, apiresponses.ErrAppGuidNotProvided
 	}
+	if kind == kubernetesBinding {
+		if _, err := b.kubernetesVolumeSourcer(); err != nil {
+			logger.Error("err-unsupported-platform", err)
+			return domain.Binding{}, err
+		}
+	}
+
+	if err := b.evaluateInstanceSharePolicy(logger, instanceDetails, bindDetails); err != nil {
+		return domain.Binding{}, err
+	}
+
+	volumeMount, err := b.volumeMount(logger, instanceID, instanceDetails, bindDetails)
+	if err != nil {
+		return domain.Binding{}, err
+	}
+
+	appGUID := ""
+	if kind == appBinding {
+		appGUID = bindingAppGUID(bindDetails)
+
+		// bindings for the app may be for other instances, so the check and the
+		// record of the mount path are made under the lock of the app
+		if err := b.appLocks.Lock(ctx, appGUID); err != nil {
+			return domain.Binding{}, abandon(logger, err)
+		}
+		defer b.appLocks.Unlock(appGUID)
+
+		if err := b.checkMountPathConflicts(logger, appGUID, bindingID, volumeMount.ContainerDir); err != nil {
+			return domain.Binding{}, err
+		}
+	}
+
+	if b.belongsToOtherInstance(bindingID, instanceID) || b.bindingConflicts(bindingID, bindDetails) {
+		return domain.Binding{}, apiresponses.ErrBindingAlreadyExists
+	}
+
+	logger.Info("retrieved-instance-details", lager.Data{"instanceDetails": instanceDetails})
+
+	if err := ctx.Err(); err != nil {
+		return domain.Binding{}, abandon(logger, err)
+	}
+
+	if b.AsyncOperations && asyncAllowed {
+		// the binding is recorded against the instance straight away, so that
+		// the instance is not deprovisioned from under it
+		if err := b.recordBinding(instanceID, instanceDetails, bindingID, appGUID, volumeMount.ContainerDir); err != nil {
+			return domain.Binding{}, fmt.Errorf("failed to record binding: %s", err.Error())
+		}
+
+		err = b.operations.start(bindingOperationRecord, bindingID, bindOperation)
+		if err != nil {
+			if appGUID != "" {
+				b.removeMountPath(logger, appGUID, bindingID)
+			}
+			b.forgetBinding(logger, instanceID, bindingID)
+			return domain.Binding{}, fmt.Errorf("failed to store operation state: %s", err.Error())
+		}
+
+		go b.runAsync(logger, instanceID, bindingOperationRecord, bindingID, bindOperation, func() error {
+			if err := b.store.CreateBindingDetails(bindingID, bindDetails); err != nil {
+				b.forgetMountPath(logger, bindingID, bindDetails)
+				b.forgetBinding(logger, instanceID, bindingID)
+				return err
+			}
+			return nil
+		})
+
+		return domain.Binding{IsAsync: true, OperationData: bindOperation}, nil
+	}
 
-	opts, err := getFingerprint(instanceDetails.ServiceFingerPrint)
+	err = b.store.CreateBindingDetails(bindingID, bindDetails)
 	if err != nil {
 		return domain.Binding{}, err
 	}
 
+	if err := b.recordBinding(instanceID, instanceDetails, bindingID, appGUID, volumeMount.ContainerDir); err != nil {
+		return domain.Binding{}, fmt.Errorf("failed to record binding: %s", err.Error())
+	}
+
+	// an earlier asynchronous bind that failed is superseded
+	b.operations.forget(logger, bindingOperationRecord, bindingID)
+
+	credentials, volumeMounts, err := b.bindingCredentials(kind, instanceDetails, bindDetails, volumeMount)
+	if err != nil {
+		return domain.Binding{}, err
+	}
+
+	ret := domain.Binding{
+		Credentials:  credentials,
+		VolumeMounts: volumeMounts,
+	}
+	return ret, nil
+}
+
+// volumeMount computes the volume mount for a binding from the service instance
+// fingerprint and the bind parameters. It is used both when creating a binding and
+// when fetching one, so the two always agree.
+func (b *Broker) volumeMount(logger lager.Logger, instanceID string, instanceDetails brokerstore.ServiceInstance, bindDetails domain.BindDetails) (domain.VolumeMount, error) {
+	fingerprint, err := getFingerprint(instanceDetails.ServiceFingerPrint)
+	if err != nil {
+		return domain.VolumeMount{}, err
+	}
+
+	opts := map[string]interface{}{}
+	for k, v := range fingerprint {
+		opts[k] = v
+	}
+
 	var bindOpts map[string]interface{}
 	if len(bindDetails.RawParameters) > 0 {
 		if err = json.Unmarshal(bindDetails.RawParameters, &bindOpts); err != nil {
-			return domain.Binding{}, err
+			return domain.VolumeMount{}, err
 		}
 	}
 
@@ -229,7 +572,7 @@ func (b *Broker) Bind(context context.Context, instanceID string, bindingID stri
 			if k == disallowed {
 				err := errors.New(fmt.Sprintf("bind configuration contains the following invalid option: ['%s']", k))
 				logger.Error("err-override-not-allowed-in-bind", err, lager.Data{"key": k})
-				return domain.Binding{}, apiresponses.NewFailureResponse(
+				return domain.VolumeMount{}, apiresponses.NewFailureResponse(
 					err, http.StatusBadRequest, "invalid-raw-params",
 				)
 
@@ -238,47 +581,85 @@ func (b *Broker) Bind(context context.Context, instanceID string, bindingID stri
 		opts[k] = v
 	}
 
-	mode, err := evaluateMode(opts)
+	subpath := ""
+	if value, ok := bindOpts[SUBPATH_KEY]; ok {
+		if subpath, err = validateSubpath(value); err != nil {
+			logger.Error("err-invalid-subpath", err)
+			return domain.VolumeMount{}, err
+		}
+		delete(opts, SUBPATH_KEY)
+	}
+
+	mask := b.configMaskFor(instanceDetails.PlanID)
+
+	instanceMode, err := evaluateMode(fingerprint, mask)
 	if err != nil {
 		logger.Error("error-evaluating-mode", err)
-		return domain.Binding{}, err
+		return domain.VolumeMount{}, err
 	}
+	readOnly := instanceMode == "r" || containsString(b.ReadOnlyPlans, instanceDetails.PlanID)
 
-	mountOpts, err := vmo.NewMountOpts(opts, b.configMask)
-	if err != nil {
-		logger.Error("error-generating-mount-options", err)
-		return domain.Binding{}, apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-params")
+	if readOnly {
+		if setsReadWrite(bindOpts, mask) {
+			err := errors.New("service instance is read-only and cannot be bound read-write")
+			logger.Error("err-read-write-bind-of-read-only-instance", err)
+			return domain.VolumeMount{}, apiresponses.NewFailureResponse(err, http.StatusForbidden, "read-only-instance")
+		}
+
+		// a single key is left, so the mask cannot map several names of the
+		// option in an arbitrary order
+		for _, key := range readOnlyKeys(mask) {
+			delete(opts, key)
+		}
+		if maskAllows(mask, "readonly") {
+			opts["readonly"] = true
+		}
 	}
 
-	if b.bindingConflicts(bindingID, bindDetails) {
-		return domain.Binding{}, apiresponses.ErrBindingAlreadyExists
+	containerDir, err := evaluateContainerPath(opts, instanceID, b.DisallowedMountPaths)
+	if err != nil {
+		return domain.VolumeMount{}, invalidMountPath(logger, err)
 	}
 
-	logger.Info("retrieved-instance-details", lager.Data{"instanceDetails": instanceDetails})
+	mountOpts, err := vmo.NewMountOpts(opts, mask)
+	if err != nil {
+		logger.Error("error-generating-mount-options", err)
+		return domain.VolumeMount{}, apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-params")
+	}
 
-	err = b.store.CreateBindingDetails(bindingID, bindDetails)
+	// options the mask does not allow are reported before the values of the
+	// ones it does
+	mode, err := evaluateMode(opts, mask)
 	if err != nil {
-		return domain.Binding{}, err
+		logger.Error("error-evaluating-mode", err)
+		return domain.VolumeMount{}, err
+	}
+	if readOnly {
+		mode = "r"
 	}
 
-	driverName := "smbdriver"
-	if b.isNFSBroker() {
-		driverName = "nfsv3driver"
+	if source, ok := mountOpts[SOURCE_KEY]; ok {
+		share := stringifyShare(source)
+		if subpath != "" {
+			// the subpath changes the source, and so the volume ID hashed from it
+			share = joinSubpath(share, subpath)
+		}
+		mountOpts[SOURCE_KEY] = b.protocol.Source(share)
+	}
+	driverName := b.protocol.DriverName()
 
-		// for backwards compatibility the nfs flavor has to issue source strings
-		// with nfs:// prefix (otherwise the mapfs-mounter wont construct the correct
-		// mount string for the kernel mount
-		//
-		// see (https://github.com/cloudfoundry/nfsv3driver/blob/ac1e1d26fec9a8551cacfabafa6e035f233c83e0/mapfs_mounter.go#L121)
-		mountOpts[SOURCE_KEY] = fmt.Sprintf("nfs://%s", mountOpts[SOURCE_KEY])
+	mountOpts, err = b.protocol.MountConfig(mountOpts)
+	if err != nil {
+		logger.Error("error-generating-mount-config", err)
+		return domain.VolumeMount{}, apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-params")
 	}
 
 	logger.Debug("volume-service-binding", lager.Data{"driver": driverName, "mountOpts": mountOpts})
 
 	s, err := b.hash(mountOpts)
 	if err != nil {
-		logger.Error("error-calculating-volume-id", err, lager.Data{"config": mountOpts, "bindingID": bindingID, "instanceID": instanceID})
-		return domain.Binding{}, err
+		logger.Error("error-calculating-volume-id", err, lager.Data{"config": mountOpts, "instanceID": instanceID})
+		return domain.VolumeMount{}, err
 	}
 	volumeId := fmt.Sprintf("%s-%s", instanceID, s)
 
@@ -288,20 +669,30 @@ func (b *Broker) Bind(context context.Context, instanceID string, bindingID stri
 		mountConfig[k] = v
 	}
 
-	ret := domain.Binding{
-		Credentials: struct{}{}, // if nil, cloud controller chokes on response
-		VolumeMounts: []domain.VolumeMount{{
-			ContainerDir: evaluateContainerPath(opts, instanceID),
-			Mode:         mode,
-			Driver:       driverName,
-			DeviceType:   "shared",
-			Device: domain.SharedDevice{
-				VolumeId:    volumeId,
-				MountConfig: mountConfig,
-			},
-		}},
+	return domain.VolumeMount{
+		ContainerDir: containerDir,
+		Mode:         mode,
+		Driver:       driverName,
+		DeviceType:   "shared",
+		Device: domain.SharedDevice{
+			VolumeId:    volumeId,
+			MountConfig: mountConfig,
+		},
+	}, nil
+}
+
+// configMaskFor returns the mount option mask of the plan, or the default mask
+// when the plan has none of its own.
+func (b *Broker) configMaskFor(planID string) vmo.MountOptsMask {
+	mask, ok := b.PlanConfigMasks[planID]
+	if !ok {
+		return b.configMask
 	}
-	return ret, nil
+
+	if masker, ok := b.protocol.(MountOptionsMasker); ok {
+		mask = masker.Mask(mask)
+	}
+	return mask
 }
 
 func (b *Broker) hash(mountOpts map[string]interface{}) (string, error) {
@@ -315,13 +706,15 @@ func (b *Broker) hash(mountOpts map[string]interface{}) (string, error) {
 	return fmt.Sprintf("%x", md5.Sum(bytes)), nil
 }
 
-func (b *Broker) Unbind(context context.Context, instanceID string, bindingID string, details domain.UnbindDetails, _ bool) (_ domain.UnbindSpec, e error) {
+func (b *Broker) Unbind(ctx context.Context, instanceID string, bindingID string, details domain.UnbindDetails, _ bool) (_ domain.UnbindSpec, e error) {
 	logger := b.logger.Session("unbind")
 	logger.Info("start")
 	defer logger.Info("end")
 
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
+	if err := b.locks.Lock(ctx, instanceID); err != nil {
+		return domain.UnbindSpec{}, abandon(logger, err)
+	}
+	defer b.locks.Unlock(instanceID)
 	defer func() {
 		out := b.store.Save(logger)
 		if e == nil {
@@ -329,79 +722,413 @@ func (b *Broker) Unbind(context context.Context, instanceID string, bindingID st
 		}
 	}()
 
-	if _, err := b.store.RetrieveInstanceDetails(instanceID); err != nil {
+	if _, err := b.retrieveInstance(instanceID); err != nil {
 		return domain.UnbindSpec{}, apiresponses.ErrInstanceDoesNotExist
 	}
 
-	if _, err := b.store.RetrieveBindingDetails(bindingID); err != nil {
+	bindDetails, err := b.retrieveBinding(bindingID)
+	if err != nil || b.belongsToOtherInstance(bindingID, instanceID) {
 		return domain.UnbindSpec{}, apiresponses.ErrBindingDoesNotExist
 	}
 
+	if err := ctx.Err(); err != nil {
+		return domain.UnbindSpec{}, abandon(logger, err)
+	}
+
 	if err := b.store.DeleteBindingDetails(bindingID); err != nil {
 		return domain.UnbindSpec{}, err
 	}
+
+	b.forgetMountPath(logger, bindingID, bindDetails)
+	b.forgetBinding(logger, instanceID, bindingID)
+	b.operations.forget(logger, bindingOperationRecord, bindingID)
+
 	return domain.UnbindSpec{}, nil
 }
 
-func (b *Broker) Update(context context.Context, instanceID string, details domain.UpdateDetails, _ bool) (domain.UpdateServiceSpec, error) {
-	return domain.UpdateServiceSpec{},
-		apiresponses.NewFailureResponse(
-			errors.New("This service does not support instance updates. Please delete your service instance and create a new one with updated configuration."),
-			422,
-			"",
-		)
+func (b *Broker) Update(ctx context.Context, instanceID string, details domain.UpdateDetails, _ bool) (_ domain.UpdateServiceSpec, e error) {
+	logger := b.logger.Session("update").WithData(lager.Data{"instanceID": instanceID})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	var configuration map[string]interface{}
+	if len(details.RawParameters) > 0 {
+		if err := json.Unmarshal(details.RawParameters, &configuration); err != nil {
+			return domain.UpdateServiceSpec{}, apiresponses.ErrRawParamsInvalid
+		}
+	}
+
+	if _, ok := configuration[SOURCE_KEY]; ok {
+		return domain.UpdateServiceSpec{}, errors.New("update configuration contains the following invalid option: ['" + SOURCE_KEY + "']")
+	}
+
+	if err := b.validateInstanceMountPath(logger, configuration); err != nil {
+		return domain.UpdateServiceSpec{}, err
+	}
+
+	var parsedShare *Share
+	if share, ok := configuration[SHARE_KEY]; ok && share != nil {
+		parsed, err := b.protocol.ParseShare(stringifyShare(share))
+		if err != nil {
+			return domain.UpdateServiceSpec{}, err
+		}
+		parsedShare = &parsed
+		configuration[SHARE_KEY] = parsedShare.Canonical
+	}
+
+	if err := b.locks.Lock(ctx, instanceID); err != nil {
+		return domain.UpdateServiceSpec{}, abandon(logger, err)
+	}
+	defer b.locks.Unlock(instanceID)
+	defer func() {
+		out := b.store.Save(logger)
+		if e == nil {
+			e = out
+		}
+	}()
+
+	instanceDetails, err := b.retrieveInstance(instanceID)
+	if err != nil {
+		return domain.UpdateServiceSpec{}, apiresponses.ErrInstanceDoesNotExist
+	}
+
+	if parsedShare != nil {
+		if err := b.evaluateSharePolicy(logger, *parsedShare, instanceDetails.OrganizationGUID, instanceDetails.SpaceGUID); err != nil {
+			return domain.UpdateServiceSpec{}, err
+		}
+	}
+
+	fingerprint, err := getFingerprint(instanceDetails.ServiceFingerPrint)
+	if err != nil {
+		return domain.UpdateServiceSpec{}, err
+	}
+
+	// instances provisioned before shares were normalized are compared by the
+	// canonical form of their share
+	existing := map[string]interface{}{}
+	for k, v := range fingerprint {
+		existing[k] = v
+	}
+	if parsedShare, err := b.protocol.ParseShare(stringifyShare(fingerprint[SHARE_KEY])); err == nil {
+		existing[SHARE_KEY] = parsedShare.Canonical
+	}
+
+	for _, immutable := range b.ImmutableUpdateKeys {
+		if v, ok := configuration[immutable]; ok && !reflect.DeepEqual(v, existing[immutable]) {
+			err := fmt.Errorf("update configuration cannot change the following option: ['%s']", immutable)
+			logger.Error("err-immutable-option-changed-in-update", err, lager.Data{"key": immutable})
+			return domain.UpdateServiceSpec{}, apiresponses.NewFailureResponse(err, http.StatusUnprocessableEntity, "immutable-option")
+		}
+	}
+
+	// the spelling of the share is kept when it is the same share, as the
+	// volume IDs of the instance are hashed from it
+	if parsedShare != nil {
+		if share, ok := b.storedShareSpelling(fingerprint, parsedShare.Canonical); ok {
+			configuration[SHARE_KEY] = share
+		}
+	}
+
+	// existing bindings keep their volume mounts, only bindings created after the
+	// update see the new configuration. A null value removes the key.
+	updatedFingerprint := map[string]interface{}{}
+	for k, v := range fingerprint {
+		updatedFingerprint[k] = v
+	}
+	for k, v := range configuration {
+		if v == nil {
+			delete(updatedFingerprint, k)
+			continue
+		}
+		updatedFingerprint[k] = v
+	}
+
+	// the instance must satisfy the mask of the plan it is moving to
+	mask := b.configMaskFor(instanceDetails.PlanID)
+	planChanged := details.PlanID != "" && details.PlanID != instanceDetails.PlanID
+	if planChanged {
+		instanceDetails.PlanID = details.PlanID
+	}
+
+	// a read-only instance stays read-only, as otherwise lifting readonly would
+	// let the next binding mount it read-write
+	if err := relaxesReadOnly(fingerprint, mask, updatedFingerprint, b.configMaskFor(instanceDetails.PlanID)); err != nil {
+		logger.Error("err-read-only-relaxed-in-update", err)
+		return domain.UpdateServiceSpec{}, err
+	}
+
+	if len(configuration) > 0 || planChanged {
+		if _, err := vmo.NewMountOpts(updatedFingerprint, b.configMaskFor(instanceDetails.PlanID)); err != nil {
+			logger.Error("error-validating-mount-options", err)
+			return domain.UpdateServiceSpec{}, apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-params")
+		}
+	}
+
+	instanceDetails.ServiceFingerPrint = updatedFingerprint
+
+	if err := ctx.Err(); err != nil {
+		return domain.UpdateServiceSpec{}, abandon(logger, err)
+	}
+
+	err = b.store.CreateInstanceDetails(instanceID, instanceDetails)
+	if err != nil {
+		return domain.UpdateServiceSpec{}, fmt.Errorf("failed to store instance details: %s", err.Error())
+	}
+
+	logger.Info("service-instance-updated", lager.Data{"instanceDetails": instanceDetails})
+
+	return domain.UpdateServiceSpec{IsAsync: false}, nil
 }
 
-func (b *Broker) LastOperation(_ context.Context, instanceID string, _ domain.PollDetails) (domain.LastOperation, error) {
-	logger := b.logger.Session("last-operation").WithData(lager.Data{"instanceID": instanceID})
+func (b *Broker) LastOperation(_ context.Context, instanceID string, details domain.PollDetails) (domain.LastOperation, error) {
+	logger := b.logger.Session("last-operation").WithData(lager.Data{"instanceID": instanceID, "operation": details.OperationData})
 	logger.Info("start")
 	defer logger.Info("end")
 
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
+	// polling deliberately does not take the instance lock, which is held by the
+	// operation being polled for as long as it runs
+	if details.OperationData != provisionOperation {
+		return domain.LastOperation{}, errors.New("unrecognized operationData")
+	}
+
+	lastOperation, err := b.operations.lastOperation(instanceOperationRecord, instanceID, provisionOperation)
+	if err == errOperationNotFound {
+		// instances provisioned synchronously have no operation record
+		if _, err := b.retrieveInstance(instanceID); err != nil {
+			return domain.LastOperation{}, apiresponses.ErrInstanceDoesNotExist
+		}
+		return domain.LastOperation{State: domain.Succeeded}, nil
+	}
+	if err != nil {
+		logger.Error("error-retrieving-operation", err)
+		return domain.LastOperation{}, err
+	}
 
-	return domain.LastOperation{}, errors.New("unrecognized operationData")
+	return lastOperation, nil
 }
 
 func (b *Broker) GetInstance(ctx context.Context, instanceID string, details domain.FetchInstanceDetails) (domain.GetInstanceDetailsSpec, error) {
-	panic("implement me")
+	logger := b.logger.Session("get-instance").WithData(lager.Data{"instanceID": instanceID})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if err := b.locks.Lock(ctx, instanceID); err != nil {
+		return domain.GetInstanceDetailsSpec{}, abandon(logger, err)
+	}
+	defer b.locks.Unlock(instanceID)
+
+	instanceDetails, err := b.retrieveInstance(instanceID)
+	if err != nil {
+		return domain.GetInstanceDetailsSpec{}, apiresponses.ErrInstanceDoesNotExist
+	}
+
+	parameters, err := getFingerprint(instanceDetails.ServiceFingerPrint)
+	if err != nil {
+		logger.Error("error-deserializing-fingerprint", err)
+		return domain.GetInstanceDetailsSpec{}, err
+	}
+
+	return domain.GetInstanceDetailsSpec{
+		ServiceID:  instanceDetails.ServiceID,
+		PlanID:     instanceDetails.PlanID,
+		Parameters: b.sanitizeParameters(parameters),
+	}, nil
 }
 
 func (b *Broker) LastBindingOperation(ctx context.Context, instanceID, bindingID string, details domain.PollDetails) (domain.LastOperation, error) {
-	panic("implement me")
+	logger := b.logger.Session("last-binding-operation").WithData(lager.Data{"instanceID": instanceID, "bindingID": bindingID, "operation": details.OperationData})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if details.OperationData != bindOperation {
+		return domain.LastOperation{}, errors.New("unrecognized operationData")
+	}
+
+	lastOperation, err := b.operations.lastOperation(bindingOperationRecord, bindingID, bindOperation)
+	if err == errOperationNotFound {
+		// bindings created synchronously have no operation record
+		if _, err := b.retrieveBinding(bindingID); err != nil {
+			return domain.LastOperation{}, apiresponses.ErrBindingDoesNotExist
+		}
+		return domain.LastOperation{State: domain.Succeeded}, nil
+	}
+	if err != nil {
+		logger.Error("error-retrieving-operation", err)
+		return domain.LastOperation{}, err
+	}
+
+	return lastOperation, nil
 }
 
 func (b *Broker) GetBinding(ctx context.Context, instanceID, bindingID string, details domain.FetchBindingDetails) (domain.GetBindingSpec, error) {
-	panic("implement me")
+	logger := b.logger.Session("get-binding").WithData(lager.Data{"instanceID": instanceID, "bindingID": bindingID})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if err := b.locks.Lock(ctx, instanceID); err != nil {
+		return domain.GetBindingSpec{}, abandon(logger, err)
+	}
+	defer b.locks.Unlock(instanceID)
+
+	instanceDetails, err := b.retrieveInstance(instanceID)
+	if err != nil {
+		return domain.GetBindingSpec{}, apiresponses.ErrInstanceDoesNotExist
+	}
+
+	bindDetails, err := b.retrieveBinding(bindingID)
+	if err != nil || b.belongsToOtherInstance(bindingID, instanceID) {
+		return domain.GetBindingSpec{}, apiresponses.ErrBindingNotFound
+	}
+	instanceDetails = b.boundInstance(bindingID, instanceID, instanceDetails)
+
+	if hasRedactedParameters(bindDetails) {
+		err := errors.New("binding was stored with its parameters redacted, so its volume mount cannot be reconstructed")
+		logger.Error("err-binding-parameters-redacted", err)
+		return domain.GetBindingSpec{}, apiresponses.NewFailureResponse(err, http.StatusUnprocessableEntity, "binding-parameters-redacted")
+	}
+
+	volumeMount, err := b.volumeMount(logger, instanceID, instanceDetails, bindDetails)
+	if err != nil {
+		logger.Error("error-reconstructing-volume-mount", err)
+		return domain.GetBindingSpec{}, err
+	}
+
+	var parameters map[string]interface{}
+	if len(bindDetails.RawParameters) > 0 {
+		if err = json.Unmarshal(bindDetails.RawParameters, &parameters); err != nil {
+			return domain.GetBindingSpec{}, err
+		}
+	}
+
+	kind, err := resolveBinding(bindDetails)
+	if err != nil {
+		return domain.GetBindingSpec{}, err
+	}
+
+	credentials, volumeMounts, err := b.bindingCredentials(kind, instanceDetails, bindDetails, volumeMount)
+	if err != nil {
+		return domain.GetBindingSpec{}, err
+	}
+
+	return domain.GetBindingSpec{
+		Credentials:  credentials,
+		VolumeMounts: volumeMounts,
+		Parameters:   b.sanitizeParameters(parameters),
+	}, nil
+}
+
+// abandon turns the error of a cancelled or expired request context into a
+// failure response, logging the operation that is given up on.
+func abandon(logger lager.Logger, err error) error {
+	logger.Error("operation-abandoned", err)
+	return apiresponses.NewFailureResponse(err, http.StatusServiceUnavailable, "operation-abandoned")
 }
 
 func (b *Broker) instanceConflicts(details brokerstore.ServiceInstance, instanceID string) bool {
 	return b.store.IsInstanceConflict(instanceID, brokerstore.ServiceInstance(details))
 }
 
+// storedShareSpelling returns the share of a fingerprint when it spells the
+// given canonical share, as instances stored before shares were normalized
+// may.
+func (b *Broker) storedShareSpelling(fingerprint map[string]interface{}, canonical string) (string, bool) {
+	stored := stringifyShare(fingerprint[SHARE_KEY])
+	parsed, err := b.protocol.ParseShare(stored)
+	if err != nil || parsed.Canonical != canonical {
+		return "", false
+	}
+	return stored, true
+}
+
 func (b *Broker) bindingConflicts(bindingID string, details domain.BindDetails) bool {
 	return b.store.IsBindingConflict(bindingID, details)
 }
 
-func evaluateContainerPath(parameters map[string]interface{}, volId string) string {
+func evaluateContainerPath(parameters map[string]interface{}, volId string, disallowed []string) (string, error) {
 	if containerPath, ok := parameters["mount"]; ok && containerPath != "" {
-		return containerPath.(string)
+		mountPath, ok := containerPath.(string)
+		if !ok {
+			return "", errors.New("mount path must be a string")
+		}
+		return validateMountPath(mountPath, disallowed)
+	}
+
+	return path.Join(DEFAULT_CONTAINER_PATH, volId), nil
+}
+
+func evaluateMode(parameters map[string]interface{}, mask vmo.MountOptsMask) (string, error) {
+	mode := "rw"
+	for _, key := range readOnlyKeys(mask) {
+		if ro, ok := parameters[key]; ok {
+			roc := vmou.InterfaceToString(ro)
+			if roc != "true" {
+				return "", apiresponses.NewFailureResponse(fmt.Errorf("Invalid ro parameter value: %q", roc), http.StatusBadRequest, "invalid-ro-param")
+			}
+			mode = "r"
+		}
+	}
+
+	return mode, nil
+}
+
+// readOnlyKeys returns the parameter names that make a mount read-only under
+// the mask: readonly, the option the mask maps it to, and the other names the
+// mask gives that option.
+func readOnlyKeys(mask vmo.MountOptsMask) []string {
+	canonicalKey := "readonly"
+	if key, ok := mask.KeyPerms[canonicalKey]; ok {
+		canonicalKey = key
+	}
+
+	keys := []string{"readonly"}
+	if canonicalKey != "readonly" {
+		keys = append(keys, canonicalKey)
 	}
+	for key, mapped := range mask.KeyPerms {
+		if mapped == canonicalKey && !containsString(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
 
-	return path.Join(DEFAULT_CONTAINER_PATH, volId)
+	return keys
 }
 
-func evaluateMode(parameters map[string]interface{}) (string, error) {
-	if ro, ok := parameters["readonly"]; ok {
-		roc := vmou.InterfaceToString(ro)
-		if roc == "true" {
-			return "r", nil
+// setsReadWrite reports whether parameters give any of the read-only keys of
+// the mask a value other than true.
+func setsReadWrite(parameters map[string]interface{}, mask vmo.MountOptsMask) bool {
+	for _, key := range readOnlyKeys(mask) {
+		if ro, ok := parameters[key]; ok && vmou.InterfaceToString(ro) != "true" {
+			return true
 		}
+	}
+	return false
+}
 
-		return "", apiresponses.NewFailureResponse(fmt.Errorf("Invalid ro parameter value: %q", roc), http.StatusBadRequest, "invalid-ro-param")
+// relaxesReadOnly fails an update that would make a read-only instance
+// read-write, by removing its read-only keys or setting one of them to
+// anything but true.
+func relaxesReadOnly(fingerprint map[string]interface{}, mask vmo.MountOptsMask, updatedFingerprint map[string]interface{}, updatedMask vmo.MountOptsMask) error {
+	mode, err := evaluateMode(fingerprint, mask)
+	if err != nil || mode != "r" {
+		return nil
 	}
 
-	return "rw", nil
+	updatedMode, err := evaluateMode(updatedFingerprint, updatedMask)
+	if err != nil || updatedMode != "r" {
+		return apiresponses.NewFailureResponse(
+			errors.New("update configuration cannot make a read-only service instance read-write"),
+			http.StatusUnprocessableEntity, "immutable-option",
+		)
+	}
+	return nil
+}
+
+func maskAllows(mask vmo.MountOptsMask, key string) bool {
+	if canonicalKey, ok := mask.KeyPerms[key]; ok {
+		key = canonicalKey
+	}
+	return containsString(mask.Allowed, key)
 }
 
 func getFingerprint(rawObject interface{}) (map[string]interface{}, error) {
@@ -418,6 +1145,41 @@ func getFingerprint(rawObject interface{}) (map[string]interface{}, error) {
 	}
 }
 
+// hasRedactedParameters reports whether a binding was stored with its
+// parameters replaced by their hash, as stores may do to keep secrets out.
+func hasRedactedParameters(bindDetails domain.BindDetails) bool {
+	var parameters map[string]interface{}
+	if err := json.Unmarshal(bindDetails.RawParameters, &parameters); err != nil {
+		return false
+	}
+
+	_, ok := parameters[brokerstore.HashKey]
+	return ok && len(parameters) == 1
+}
+
+// sensitiveKeys returns the parameter names the broker neither logs nor hands
+// back: the configured ones and the secrets, which cannot be configured away.
+func (b *Broker) sensitiveKeys() []string {
+	return append(append([]string{}, secretParameterKeys...), b.SensitiveKeys...)
+}
+
+func (b *Broker) isSensitive(key string) bool {
+	return isSensitiveKey(b.sensitiveKeys(), key)
+}
+
+// sanitizeParameters returns a copy of parameters without any sensitive keys,
+// so that they can be handed back to the platform.
+func (b *Broker) sanitizeParameters(parameters map[string]interface{}) map[string]interface{} {
+	sanitized := map[string]interface{}{}
+	for k, v := range parameters {
+		if b.isSensitive(k) {
+			continue
+		}
+		sanitized[k] = v
+	}
+	return sanitized
+}
+
 func stringifyShare(data interface{}) string {
 	if val, ok := data.(string); ok {
 		return val
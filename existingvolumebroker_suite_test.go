@@ -1,13 +1,98 @@
 package existingvolumebroker_test
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/fakes"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	vmo "code.cloudfoundry.org/volume-mount-options"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
 )
 
 func TestBroker(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Broker Suite")
 }
+
+// testConfigMask returns a config mask allowing the given options, with share
+// and readonly accepted for source and ro.
+func testConfigMask(allowed ...string) vmo.MountOptsMask {
+	configMask, err := vmo.NewMountOptsMask(
+		allowed,
+		map[string]interface{}{},
+		map[string]string{"share": "source", "readonly": "ro"},
+		[]string{},
+		[]string{"source"},
+	)
+	Expect(err).NotTo(HaveOccurred())
+	return configMask
+}
+
+// newTestBroker returns a broker of the given type and config mask, backed by
+// the given store.
+func newTestBroker(brokerType existingvolumebroker.BrokerType, logger lager.Logger, configMask vmo.MountOptsMask, store brokerstore.Store) *existingvolumebroker.Broker {
+	return existingvolumebroker.New(
+		brokerType,
+		logger,
+		&fakes.FakeServices{},
+		&os_fake.FakeOs{},
+		nil,
+		store,
+		configMask,
+	)
+}
+
+// testBroker is a broker under test that provisions and binds its service
+// instances synchronously.
+type testBroker struct {
+	*existingvolumebroker.Broker
+}
+
+// provisionTestBroker returns a test broker of the given type and config mask,
+// backed by the given store, with the given instances provisioned with the
+// given parameters.
+func provisionTestBroker(brokerType existingvolumebroker.BrokerType, logger lager.Logger, configMask vmo.MountOptsMask, store brokerstore.Store, parameters string, instanceIDs ...string) testBroker {
+	broker := testBroker{newTestBroker(brokerType, logger, configMask, store)}
+	for _, instanceID := range instanceIDs {
+		broker.provision(instanceID, parameters)
+	}
+	return broker
+}
+
+// provision provisions a service instance with the given parameters, failing
+// the spec when it cannot be.
+func (b testBroker) provision(instanceID string, parameters string) {
+	_, err := b.Provision(context.TODO(), instanceID, domain.ProvisionDetails{
+		RawParameters: json.RawMessage(parameters),
+	}, false)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+}
+
+func (b testBroker) bind(instanceID string, bindingID string, bindDetails domain.BindDetails) (domain.Binding, error) {
+	return b.Bind(context.TODO(), instanceID, bindingID, bindDetails, false)
+}
+
+// bindApp binds a service instance for an app with the given parameters, or
+// for no app, like a service key, when the app GUID is empty.
+func (b testBroker) bindApp(instanceID string, bindingID string, appGUID string, parameters string) (domain.Binding, error) {
+	return b.bind(instanceID, bindingID, domain.BindDetails{
+		AppGUID:       appGUID,
+		RawParameters: json.RawMessage(parameters),
+	})
+}
+
+// bindKubernetes binds a service instance for a namespace of a Kubernetes
+// platform with the given parameters.
+func (b testBroker) bindKubernetes(instanceID string, bindingID string, parameters string) (domain.Binding, error) {
+	return b.bind(instanceID, bindingID, domain.BindDetails{
+		RawContext:    json.RawMessage(`{"platform":"kubernetes","namespace":"default"}`),
+		RawParameters: json.RawMessage(parameters),
+	})
+}
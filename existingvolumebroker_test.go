@@ -6,9 +6,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"code.cloudfoundry.org/existingvolumebroker"
 	"code.cloudfoundry.org/existingvolumebroker/fakes"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
 	"code.cloudfoundry.org/goshims/osshim/os_fake"
 	"code.cloudfoundry.org/lager/v3/lagertest"
 	"code.cloudfoundry.org/service-broker-store/brokerstore"
@@ -374,6 +377,64 @@ var _ = Describe("Broker", func() {
 						Expect(err).To(HaveOccurred())
 					})
 				})
+
+				Context("when the instance still has bindings", func() {
+					BeforeEach(func() {
+						fakeStore.RetrieveInstanceDetailsStub = func(id string) (brokerstore.ServiceInstance, error) {
+							if id == "existingvolumebroker-records/instance-bindings/some-instance-id" {
+								return brokerstore.ServiceInstance{ServiceFingerPrint: map[string]interface{}{
+									"bindings": []interface{}{"binding-2", "binding-1"},
+									"complete": true,
+								}}, nil
+							}
+							return brokerstore.ServiceInstance{ServiceID: instanceID}, nil
+						}
+						// the CredHub store cannot list bindings
+						fakeStore.RetrieveAllBindingDetailsStub = func() (map[string]domain.BindDetails, error) {
+							panic("Not Implemented")
+						}
+					})
+
+					It("refuses to deprovision the instance with a conflict", func() {
+						Expect(err).To(MatchError("service instance still has bindings: ['binding-1', 'binding-2']"))
+						Expect(err).To(BeAssignableToTypeOf(&apiresponses.FailureResponse{}))
+						Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(409))
+						Expect(fakeStore.DeleteInstanceDetailsCallCount()).To(BeZero())
+						Expect(fakeStore.DeleteBindingDetailsCallCount()).To(BeZero())
+					})
+
+					Context("when the broker cascades deprovisions to bindings", func() {
+						BeforeEach(func() {
+							broker.(*existingvolumebroker.Broker).DeprovisionPolicy = existingvolumebroker.DeprovisionPolicyCascade
+						})
+
+						It("deletes the bindings of the instance along with the instance", func() {
+							Expect(err).NotTo(HaveOccurred())
+
+							Expect(fakeStore.DeleteBindingDetailsCallCount()).To(Equal(2))
+							Expect(fakeStore.DeleteBindingDetailsArgsForCall(0)).To(Equal("binding-1"))
+							Expect(fakeStore.DeleteBindingDetailsArgsForCall(1)).To(Equal("binding-2"))
+							var deletedInstances []string
+							for i := 0; i < fakeStore.DeleteInstanceDetailsCallCount(); i++ {
+								deletedInstances = append(deletedInstances, fakeStore.DeleteInstanceDetailsArgsForCall(i))
+							}
+							Expect(deletedInstances).To(ContainElement("some-instance-id"))
+							Expect(deletedInstances).To(ContainElement("existingvolumebroker-records/instance-bindings/some-instance-id"))
+						})
+
+						Context("when deletion of a binding fails", func() {
+							BeforeEach(func() {
+								fakeStore.DeleteBindingDetailsReturns(errors.New("badness"))
+							})
+
+							It("should error and keep the instance", func() {
+								Expect(err).To(MatchError("badness"))
+								Expect(fakeStore.DeleteInstanceDetailsCallCount()).To(BeZero())
+							})
+						})
+					})
+				})
+
 			})
 
 			Context("when the save fails", func() {
@@ -394,6 +455,102 @@ var _ = Describe("Broker", func() {
 			})
 		})
 
+		Context(".GetInstance", func() {
+			var (
+				spec domain.GetInstanceDetailsSpec
+				err  error
+			)
+
+			BeforeEach(func() {
+				fakeStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{
+					ServiceID: "nfs-service-id",
+					PlanID:    "Existing",
+					ServiceFingerPrint: map[string]interface{}{
+						existingvolumebroker.SHARE_KEY: "server/some-share",
+						"uid":                          "1000",
+						"password":                     "some-password",
+					},
+				}, nil)
+			})
+
+			JustBeforeEach(func() {
+				spec, err = broker.GetInstance(ctx, "some-instance-id", domain.FetchInstanceDetails{})
+			})
+
+			It("retrieves the instance from the store", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeStore.RetrieveInstanceDetailsCallCount()).To(Equal(1))
+				Expect(fakeStore.RetrieveInstanceDetailsArgsForCall(0)).To(Equal("some-instance-id"))
+			})
+
+			It("returns the service and plan IDs", func() {
+				Expect(spec.ServiceID).To(Equal("nfs-service-id"))
+				Expect(spec.PlanID).To(Equal("Existing"))
+			})
+
+			It("returns the instance parameters without secrets", func() {
+				Expect(spec.Parameters).To(Equal(map[string]interface{}{
+					existingvolumebroker.SHARE_KEY: "server/some-share",
+					"uid":                          "1000",
+				}))
+			})
+
+			Context("when other keys are configured as sensitive", func() {
+				BeforeEach(func() {
+					broker.(*existingvolumebroker.Broker).SensitiveKeys = []string{"uid"}
+				})
+
+				It("leaves them out of the parameters along with the secrets", func() {
+					Expect(spec.Parameters).To(Equal(map[string]interface{}{
+						existingvolumebroker.SHARE_KEY: "server/some-share",
+					}))
+				})
+			})
+
+			It("does not modify the stored fingerprint", func() {
+				instance, _ := fakeStore.RetrieveInstanceDetails("some-instance-id")
+				Expect(instance.ServiceFingerPrint).To(HaveKey("password"))
+			})
+
+			Context("when the service instance contains a legacy service fingerprint", func() {
+				BeforeEach(func() {
+					fakeStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{
+						ServiceID:          "nfs-service-id",
+						ServiceFingerPrint: "server/some-share",
+					}, nil)
+				})
+
+				It("returns the share as a parameter", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(spec.Parameters).To(Equal(map[string]interface{}{
+						existingvolumebroker.SHARE_KEY: "server/some-share",
+					}))
+				})
+			})
+
+			Context("when the service fingerprint cannot be deserialized", func() {
+				BeforeEach(func() {
+					fakeStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{
+						ServiceFingerPrint: 42,
+					}, nil)
+				})
+
+				It("errors", func() {
+					Expect(err).To(MatchError("unable to deserialize service fingerprint"))
+				})
+			})
+
+			Context("when the instance does not exist", func() {
+				BeforeEach(func() {
+					fakeStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{}, errors.New("not found"))
+				})
+
+				It("errors", func() {
+					Expect(err).To(Equal(apiresponses.ErrInstanceDoesNotExist))
+				})
+			})
+		})
+
 		Context(".Bind", func() {
 			var (
 				instanceID, serviceID string
@@ -497,6 +654,14 @@ var _ = Describe("Broker", func() {
 				})
 			}
 
+			It("reports options that are not allowed before invalid read-only values", func() {
+				bindDetails.RawParameters = json.RawMessage(`{"ro":"sometimes","some-option":"some-value"}`)
+
+				_, err := broker.Bind(ctx, instanceID, "binding-id", bindDetails, false)
+				Expect(err).To(MatchError(ContainSubstring("Not allowed options")))
+				Expect(err.(*apiresponses.FailureResponse).LoggerAction()).To(Equal("invalid-params"))
+			})
+
 			It("includes empty credentials to prevent CAPI crash", func() {
 				binding, err := broker.Bind(ctx, instanceID, "binding-id", bindDetails, false)
 				Expect(err).NotTo(HaveOccurred())
@@ -559,6 +724,50 @@ var _ = Describe("Broker", func() {
 				Expect(binding.VolumeMounts[0].Driver).To(Equal("nfsv3driver"))
 			})
 
+			It("stores the binding with the context as given", func() {
+				bindDetails.RawContext = []byte(`{"platform":"cloudfoundry","instance_id":"platform-instance-id"}`)
+
+				_, err := broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeStore.CreateBindingDetailsCallCount()).To(Equal(1))
+				id, details := fakeStore.CreateBindingDetailsArgsForCall(0)
+				Expect(id).To(Equal("binding-id"))
+				Expect(details.RawContext).To(MatchJSON(`{"platform":"cloudfoundry","instance_id":"platform-instance-id"}`))
+				Expect(details.RawParameters).To(Equal(bindDetails.RawParameters))
+			})
+
+			It("records the binding against its instance and its app", func() {
+				_, err := broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				var records []string
+				for i := 0; i < fakeStore.CreateInstanceDetailsCallCount(); i++ {
+					id, _ := fakeStore.CreateInstanceDetailsArgsForCall(i)
+					records = append(records, id)
+				}
+				Expect(records).To(ConsistOf(
+					"existingvolumebroker-records/binding/binding-id",
+					"existingvolumebroker-records/instance-bindings/some-instance-id",
+					"existingvolumebroker-records/app-bindings/guid",
+				))
+			})
+
+			It("accepts a bind context that is not a JSON object", func() {
+				bindDetails.RawContext = []byte(`"cloudfoundry"`)
+
+				_, err := broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, false)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("errors when the bind context is not JSON", func() {
+				bindDetails.RawContext = []byte(`cloudfoundry`)
+
+				_, err := broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, false)
+				Expect(err).To(BeAssignableToTypeOf(&apiresponses.FailureResponse{}))
+				Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+			})
+
 			It("fills in the volume ID", func() {
 				binding, err := broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, false)
 				Expect(err).NotTo(HaveOccurred())
@@ -1055,14 +1264,1092 @@ var _ = Describe("Broker", func() {
 			})
 		})
 
+		Context(".GetBinding", func() {
+			var (
+				bindDetails domain.BindDetails
+				spec        domain.GetBindingSpec
+				err         error
+			)
+
+			BeforeEach(func() {
+				fakeStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{
+					ServiceID: "nfs-service-id",
+					ServiceFingerPrint: map[string]interface{}{
+						existingvolumebroker.SHARE_KEY: "server/some-share",
+					},
+				}, nil)
+
+				bindDetails = domain.BindDetails{
+					AppGUID:       "guid",
+					RawParameters: []byte(`{"uid":"1000","gid":"1000","username":"some-user","password":"some-password","mount":"/var/vcap/otherdir","readonly":true}`),
+				}
+				fakeStore.RetrieveBindingDetailsReturns(bindDetails, nil)
+			})
+
+			JustBeforeEach(func() {
+				spec, err = broker.GetBinding(ctx, "some-instance-id", "binding-id", domain.FetchBindingDetails{})
+			})
+
+			It("retrieves the binding from the store", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeStore.RetrieveBindingDetailsCallCount()).To(Equal(1))
+				Expect(fakeStore.RetrieveBindingDetailsArgsForCall(0)).To(Equal("binding-id"))
+			})
+
+			It("returns the same volume mount as bind", func() {
+				fakeStore.RetrieveBindingDetailsReturns(domain.BindDetails{}, errors.New("not found"))
+				binding, err := broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(spec.VolumeMounts).To(Equal(binding.VolumeMounts))
+			})
+
+			It("reconstructs the driver, container dir, mode and volume ID", func() {
+				Expect(spec.VolumeMounts).To(HaveLen(1))
+				Expect(spec.VolumeMounts[0].Driver).To(Equal("nfsv3driver"))
+				Expect(spec.VolumeMounts[0].ContainerDir).To(Equal("/var/vcap/otherdir"))
+				Expect(spec.VolumeMounts[0].Mode).To(Equal("r"))
+				Expect(spec.VolumeMounts[0].Device.VolumeId).To(HavePrefix("some-instance-id-"))
+				Expect(spec.VolumeMounts[0].Device.MountConfig).To(HaveKeyWithValue("source", "nfs://server/some-share"))
+			})
+
+			It("includes empty credentials to prevent CAPI crash", func() {
+				Expect(spec.Credentials).NotTo(BeNil())
+			})
+
+			It("returns the bind parameters without secrets", func() {
+				Expect(spec.Parameters).To(HaveKeyWithValue("uid", "1000"))
+				Expect(spec.Parameters).NotTo(HaveKey("password"))
+			})
+
+			Context("when the binding does not exist", func() {
+				BeforeEach(func() {
+					fakeStore.RetrieveBindingDetailsReturns(domain.BindDetails{}, errors.New("not found"))
+				})
+
+				It("errors", func() {
+					Expect(err).To(Equal(apiresponses.ErrBindingNotFound))
+				})
+			})
+
+			Context("when the instance does not exist", func() {
+				BeforeEach(func() {
+					fakeStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{}, errors.New("not found"))
+				})
+
+				It("errors", func() {
+					Expect(err).To(Equal(apiresponses.ErrInstanceDoesNotExist))
+				})
+			})
+
+			Context("when the binding was stored with its parameters redacted", func() {
+				BeforeEach(func() {
+					fakeStore.RetrieveBindingDetailsReturns(domain.BindDetails{
+						AppGUID:       "guid",
+						RawParameters: []byte(`{"paramsHash":"$2a$10$somehash"}`),
+					}, nil)
+				})
+
+				It("errors instead of reconstructing a different volume mount", func() {
+					Expect(err).To(MatchError("binding was stored with its parameters redacted, so its volume mount cannot be reconstructed"))
+					Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(422))
+				})
+			})
+
+			Context("when the stored bind parameters are no longer valid", func() {
+				BeforeEach(func() {
+					fakeStore.RetrieveBindingDetailsReturns(domain.BindDetails{
+						AppGUID:       "guid",
+						RawParameters: []byte(`{"unknown":"option"}`),
+					}, nil)
+				})
+
+				It("errors", func() {
+					Expect(err).To(MatchError(ContainSubstring("Not allowed options")))
+				})
+			})
+		})
+
 		Context(".Update", func() {
-			It("should return a 422 status code", func() {
-				_, err := broker.Update(ctx, "", domain.UpdateDetails{}, false)
-				Expect(err).To(HaveOccurred())
-				Expect(err).To(MatchError(apiresponses.NewFailureResponse(errors.New(
-					"This service does not support instance updates. Please delete your service instance and create a new one with updated configuration."),
-					422,
-					"")))
+			var (
+				updateDetails domain.UpdateDetails
+				spec          domain.UpdateServiceSpec
+				err           error
+			)
+
+			BeforeEach(func() {
+				fakeStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{
+					ServiceID:        "nfs-service-id",
+					PlanID:           "Existing",
+					OrganizationGUID: "some-org",
+					SpaceGUID:        "some-space",
+					ServiceFingerPrint: map[string]interface{}{
+						existingvolumebroker.SHARE_KEY: "server/some-share",
+						"uid":                          "1000",
+						"version":                      "3",
+					},
+				}, nil)
+
+				updateDetails = domain.UpdateDetails{
+					ServiceID:     "nfs-service-id",
+					PlanID:        "Existing",
+					RawParameters: []byte(`{"uid":"2000","version":"4.1"}`),
+				}
+			})
+
+			JustBeforeEach(func() {
+				spec, err = broker.Update(ctx, "some-instance-id", updateDetails, false)
+			})
+
+			It("updates the service instance synchronously", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(spec.IsAsync).To(BeFalse())
+			})
+
+			It("persists the new fingerprint", func() {
+				Expect(fakeStore.CreateInstanceDetailsCallCount()).To(Equal(1))
+				id, details := fakeStore.CreateInstanceDetailsArgsForCall(0)
+				Expect(id).To(Equal("some-instance-id"))
+				Expect(details.ServiceID).To(Equal("nfs-service-id"))
+				Expect(details.PlanID).To(Equal("Existing"))
+				Expect(details.OrganizationGUID).To(Equal("some-org"))
+				Expect(details.SpaceGUID).To(Equal("some-space"))
+				Expect(details.ServiceFingerPrint).To(Equal(map[string]interface{}{
+					existingvolumebroker.SHARE_KEY: "server/some-share",
+					"uid":                          "2000",
+					"version":                      "4.1",
+				}))
+			})
+
+			It("should write state", func() {
+				Expect(fakeStore.SaveCallCount()).To(Equal(1))
+			})
+
+			Context("when a parameter is set to null", func() {
+				BeforeEach(func() {
+					updateDetails.RawParameters = []byte(`{"uid":null}`)
+				})
+
+				It("removes it from the fingerprint", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, details := fakeStore.CreateInstanceDetailsArgsForCall(0)
+					Expect(details.ServiceFingerPrint).NotTo(HaveKey("uid"))
+					Expect(details.ServiceFingerPrint).To(HaveKeyWithValue("version", "3"))
+				})
+			})
+
+			Context("when the plan changes", func() {
+				BeforeEach(func() {
+					updateDetails.PlanID = "Other"
+					updateDetails.RawParameters = nil
+				})
+
+				It("persists the new plan and keeps the fingerprint", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, details := fakeStore.CreateInstanceDetailsArgsForCall(0)
+					Expect(details.PlanID).To(Equal("Other"))
+					Expect(details.ServiceFingerPrint).To(HaveKeyWithValue("uid", "1000"))
+				})
+			})
+
+			Context("when the update repeats the existing share", func() {
+				BeforeEach(func() {
+					updateDetails.RawParameters = []byte(`{"share":"server/some-share","uid":"2000"}`)
+				})
+
+				It("should not error", func() {
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("when the update changes the share", func() {
+				BeforeEach(func() {
+					updateDetails.RawParameters = []byte(`{"share":"server/some-other-share"}`)
+				})
+
+				It("errors with a 422", func() {
+					Expect(err).To(MatchError("update configuration cannot change the following option: ['share']"))
+					Expect(err).To(BeAssignableToTypeOf(&apiresponses.FailureResponse{}))
+					Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(422))
+					Expect(fakeStore.CreateInstanceDetailsCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the update contains a share with colon after server", func() {
+				BeforeEach(func() {
+					updateDetails.RawParameters = []byte(`{"share":"server:/some-share"}`)
+				})
+
+				It("errors", func() {
+					Expect(err).To(Equal(errors.New("syntax error for share: no colon allowed after server")))
+				})
+			})
+
+			Context("when the update contains a 'source' key", func() {
+				BeforeEach(func() {
+					updateDetails.RawParameters = []byte(`{"source":"server/some-share"}`)
+				})
+
+				It("errors", func() {
+					Expect(err).To(Equal(errors.New("update configuration contains the following invalid option: ['source']")))
+				})
+			})
+
+			Context("when the update contains options that are not allowed", func() {
+				BeforeEach(func() {
+					updateDetails.RawParameters = []byte(`{"unknown":"option"}`)
+				})
+
+				It("errors with a meaningful error message", func() {
+					Expect(err).To(BeAssignableToTypeOf(&apiresponses.FailureResponse{}))
+					Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+					Expect(err).To(MatchError(ContainSubstring("Not allowed options")))
+					Expect(fakeStore.CreateInstanceDetailsCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the update was given invalid JSON", func() {
+				BeforeEach(func() {
+					updateDetails.RawParameters = []byte("{this is not json")
+				})
+
+				It("errors", func() {
+					Expect(err).To(Equal(apiresponses.ErrRawParamsInvalid))
+				})
+			})
+
+			Context("when the instance does not exist", func() {
+				BeforeEach(func() {
+					fakeStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{}, errors.New("not found"))
+				})
+
+				It("errors", func() {
+					Expect(err).To(Equal(apiresponses.ErrInstanceDoesNotExist))
+				})
+			})
+
+			Context("when storing the instance fails", func() {
+				BeforeEach(func() {
+					fakeStore.CreateInstanceDetailsReturns(errors.New("badness"))
+				})
+
+				It("errors", func() {
+					Expect(err).To(MatchError("failed to store instance details: badness"))
+				})
+			})
+
+			Context("when the save fails", func() {
+				BeforeEach(func() {
+					fakeStore.SaveReturns(errors.New("badness"))
+				})
+
+				It("errors", func() {
+					Expect(err).To(HaveOccurred())
+				})
+			})
+		})
+
+		Context("when operations run concurrently", func() {
+			var (
+				release          chan struct{}
+				blocked          chan struct{}
+				provisionDetails domain.ProvisionDetails
+			)
+
+			BeforeEach(func() {
+				release = make(chan struct{})
+				blocked = make(chan struct{}, 1)
+				fakeStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{}, errors.New("not found"))
+				fakeStore.CreateInstanceDetailsStub = func(id string, details brokerstore.ServiceInstance) error {
+					if id == "instance-a" {
+						blocked <- struct{}{}
+						<-release
+					}
+					return nil
+				}
+				provisionDetails = domain.ProvisionDetails{PlanID: "Existing", RawParameters: []byte(`{"share":"server/some-share"}`)}
+			})
+
+			provisionInBackground := func(instanceID string) chan error {
+				done := make(chan error, 1)
+				go func() {
+					defer GinkgoRecover()
+					_, err := broker.Provision(ctx, instanceID, provisionDetails, false)
+					done <- err
+				}()
+				return done
+			}
+
+			It("does not block operations on other instances", func() {
+				doneA := provisionInBackground("instance-a")
+				Eventually(blocked).Should(Receive())
+
+				doneB := provisionInBackground("instance-b")
+				Eventually(doneB).Should(Receive(BeNil()))
+				Consistently(doneA).ShouldNot(Receive())
+
+				close(release)
+				Eventually(doneA).Should(Receive(BeNil()))
+			})
+
+			It("serializes operations on the same instance", func() {
+				doneA := provisionInBackground("instance-a")
+				Eventually(blocked).Should(Receive())
+
+				retrieved := fakeStore.RetrieveInstanceDetailsCallCount()
+				doneBind := make(chan error, 1)
+				go func() {
+					defer GinkgoRecover()
+					_, err := broker.Bind(ctx, "instance-a", "binding-id", domain.BindDetails{AppGUID: "guid"}, false)
+					doneBind <- err
+				}()
+				Consistently(doneBind).ShouldNot(Receive())
+				Expect(fakeStore.RetrieveInstanceDetailsCallCount()).To(Equal(retrieved))
+
+				close(release)
+				Eventually(doneA).Should(Receive(BeNil()))
+				Eventually(doneBind).Should(Receive())
+			})
+
+			It("gives up waiting for the instance lock when the request context expires", func() {
+				doneA := provisionInBackground("instance-a")
+				Eventually(blocked).Should(Receive())
+
+				timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+				defer cancel()
+
+				_, err := broker.Deprovision(timeoutCtx, "instance-a", domain.DeprovisionDetails{}, false)
+				Expect(err).To(MatchError("context deadline exceeded"))
+				Expect(err).To(BeAssignableToTypeOf(&apiresponses.FailureResponse{}))
+				Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(503))
+				Expect(logger.Buffer()).To(gbytes.Say("operation-abandoned"))
+				Expect(fakeStore.DeleteInstanceDetailsCallCount()).To(BeZero())
+
+				close(release)
+				Eventually(doneA).Should(Receive(BeNil()))
+
+				fakeStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{}, nil)
+				_, err = broker.Deprovision(ctx, "instance-a", domain.DeprovisionDetails{}, false)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("does not modify the store once the request context is cancelled", func() {
+				cancelledCtx, cancel := context.WithCancel(ctx)
+				cancel()
+
+				fakeStore.RetrieveInstanceDetailsReturns(brokerstore.ServiceInstance{}, nil)
+				_, err := broker.Unbind(cancelledCtx, "instance-b", "binding-id", domain.UnbindDetails{}, false)
+				Expect(err).To(MatchError("context canceled"))
+				Expect(fakeStore.DeleteBindingDetailsCallCount()).To(BeZero())
+			})
+		})
+
+		Context("when asynchronous operations are enabled", func() {
+			var (
+				storeLock sync.Mutex
+				instances map[string]brokerstore.ServiceInstance
+				bindings  map[string]domain.BindDetails
+				release   chan struct{}
+			)
+
+			BeforeEach(func() {
+				instances = map[string]brokerstore.ServiceInstance{}
+				bindings = map[string]domain.BindDetails{}
+				release = make(chan struct{})
+				close(release)
+
+				fakeStore.RetrieveInstanceDetailsStub = func(id string) (brokerstore.ServiceInstance, error) {
+					storeLock.Lock()
+					defer storeLock.Unlock()
+					if instance, ok := instances[id]; ok {
+						return instance, nil
+					}
+					return brokerstore.ServiceInstance{}, errors.New("not found")
+				}
+				fakeStore.CreateInstanceDetailsStub = func(id string, details brokerstore.ServiceInstance) error {
+					if id == "some-instance-id" {
+						<-release
+					}
+					storeLock.Lock()
+					defer storeLock.Unlock()
+					instances[id] = details
+					return nil
+				}
+				fakeStore.DeleteInstanceDetailsStub = func(id string) error {
+					storeLock.Lock()
+					defer storeLock.Unlock()
+					delete(instances, id)
+					return nil
+				}
+				fakeStore.RetrieveBindingDetailsStub = func(id string) (domain.BindDetails, error) {
+					storeLock.Lock()
+					defer storeLock.Unlock()
+					if binding, ok := bindings[id]; ok {
+						return binding, nil
+					}
+					return domain.BindDetails{}, errors.New("not found")
+				}
+				fakeStore.CreateBindingDetailsStub = func(id string, details domain.BindDetails) error {
+					<-release
+					storeLock.Lock()
+					defer storeLock.Unlock()
+					bindings[id] = details
+					return nil
+				}
+
+				broker.(*existingvolumebroker.Broker).AsyncOperations = true
+			})
+
+			pollProvision := func() domain.LastOperationState {
+				lastOperation, err := broker.LastOperation(ctx, "some-instance-id", domain.PollDetails{OperationData: "provision"})
+				Expect(err).NotTo(HaveOccurred())
+				return lastOperation.State
+			}
+
+			pollBind := func() domain.LastOperationState {
+				lastOperation, err := broker.LastBindingOperation(ctx, "some-instance-id", "binding-id", domain.PollDetails{OperationData: "bind"})
+				Expect(err).NotTo(HaveOccurred())
+				return lastOperation.State
+			}
+
+			Context(".Provision", func() {
+				var provisionDetails domain.ProvisionDetails
+
+				BeforeEach(func() {
+					provisionDetails = domain.ProvisionDetails{PlanID: "Existing", RawParameters: []byte(`{"share":"server/some-share"}`)}
+				})
+
+				It("provisions asynchronously when the platform allows it", func() {
+					release = make(chan struct{})
+
+					spec, err := broker.Provision(ctx, "some-instance-id", provisionDetails, true)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(spec.IsAsync).To(BeTrue())
+					Expect(spec.OperationData).To(Equal("provision"))
+
+					Expect(pollProvision()).To(Equal(domain.InProgress))
+
+					close(release)
+					Eventually(pollProvision).Should(Equal(domain.Succeeded))
+
+					_, err = broker.GetInstance(ctx, "some-instance-id", domain.FetchInstanceDetails{})
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("reports the provision already in progress when asked again", func() {
+					release = make(chan struct{})
+					defer close(release)
+
+					_, err := broker.Provision(ctx, "some-instance-id", provisionDetails, true)
+					Expect(err).NotTo(HaveOccurred())
+
+					spec, err := broker.Provision(ctx, "some-instance-id", provisionDetails, true)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(spec.IsAsync).To(BeTrue())
+					Expect(spec.OperationData).To(Equal("provision"))
+					Expect(pollProvision()).To(Equal(domain.InProgress))
+				})
+
+				It("keeps the operation apart from the instance", func() {
+					release = make(chan struct{})
+
+					_, err := broker.Provision(ctx, "some-instance-id", provisionDetails, true)
+					Expect(err).NotTo(HaveOccurred())
+
+					storeLock.Lock()
+					for id := range instances {
+						Expect(id).To(HavePrefix("existingvolumebroker-records/"))
+					}
+					storeLock.Unlock()
+
+					_, err = broker.GetInstance(ctx, "some-instance-id", domain.FetchInstanceDetails{})
+					Expect(err).To(Equal(apiresponses.ErrInstanceDoesNotExist))
+
+					close(release)
+					Eventually(pollProvision).Should(Equal(domain.Succeeded))
+				})
+
+				It("refuses IDs reserved for the records of the broker", func() {
+					_, err := broker.Provision(ctx, "existingvolumebroker-records/instance-operation/some-instance-id", provisionDetails, true)
+					Expect(err).To(MatchError("ID is reserved for the records of the broker"))
+					Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+				})
+
+				It("provisions synchronously when the platform does not allow async", func() {
+					spec, err := broker.Provision(ctx, "some-instance-id", provisionDetails, false)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(spec.IsAsync).To(BeFalse())
+					Expect(instances).To(HaveKey("some-instance-id"))
+				})
+
+				It("still rejects invalid parameters synchronously", func() {
+					provisionDetails.RawParameters = []byte(`{"share":"server:/some-share"}`)
+
+					_, err := broker.Provision(ctx, "some-instance-id", provisionDetails, true)
+					Expect(err).To(MatchError("syntax error for share: no colon allowed after server"))
+				})
+
+				Context("when storing the instance fails", func() {
+					BeforeEach(func() {
+						fakeStore.CreateInstanceDetailsStub = func(id string, details brokerstore.ServiceInstance) error {
+							if id == "some-instance-id" {
+								return errors.New("badness")
+							}
+							storeLock.Lock()
+							defer storeLock.Unlock()
+							instances[id] = details
+							return nil
+						}
+					})
+
+					It("reports the operation as failed", func() {
+						_, err := broker.Provision(ctx, "some-instance-id", provisionDetails, true)
+						Expect(err).NotTo(HaveOccurred())
+
+						Eventually(pollProvision).Should(Equal(domain.Failed))
+
+						lastOperation, err := broker.LastOperation(ctx, "some-instance-id", domain.PollDetails{OperationData: "provision"})
+						Expect(err).NotTo(HaveOccurred())
+						Expect(lastOperation.Description).To(Equal("failed to store instance details: badness"))
+					})
+
+					It("forgets the operation on deprovision", func() {
+						_, err := broker.Provision(ctx, "some-instance-id", provisionDetails, true)
+						Expect(err).NotTo(HaveOccurred())
+						Eventually(pollProvision).Should(Equal(domain.Failed))
+
+						_, err = broker.Deprovision(ctx, "some-instance-id", domain.DeprovisionDetails{}, true)
+						Expect(err).To(Equal(apiresponses.ErrInstanceDoesNotExist))
+						Expect(instances).To(BeEmpty())
+					})
+
+					It("forgets the operation once the instance is provisioned synchronously", func() {
+						_, err := broker.Provision(ctx, "some-instance-id", provisionDetails, true)
+						Expect(err).NotTo(HaveOccurred())
+						Eventually(pollProvision).Should(Equal(domain.Failed))
+
+						fakeStore.CreateInstanceDetailsStub = func(id string, details brokerstore.ServiceInstance) error {
+							storeLock.Lock()
+							defer storeLock.Unlock()
+							instances[id] = details
+							return nil
+						}
+
+						_, err = broker.Provision(ctx, "some-instance-id", provisionDetails, false)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(pollProvision()).To(Equal(domain.Succeeded))
+					})
+				})
+			})
+
+			Context(".Bind", func() {
+				var bindDetails domain.BindDetails
+
+				BeforeEach(func() {
+					instances["some-instance-id"] = brokerstore.ServiceInstance{
+						ServiceFingerPrint: map[string]interface{}{existingvolumebroker.SHARE_KEY: "server/some-share"},
+					}
+					bindDetails = domain.BindDetails{AppGUID: "guid", RawParameters: []byte(`{"uid":"1000"}`)}
+				})
+
+				It("binds asynchronously and serves the binding once done", func() {
+					release = make(chan struct{})
+
+					binding, err := broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, true)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(binding.IsAsync).To(BeTrue())
+					Expect(binding.OperationData).To(Equal("bind"))
+					Expect(binding.VolumeMounts).To(BeEmpty())
+
+					Expect(pollBind()).To(Equal(domain.InProgress))
+
+					close(release)
+					Eventually(pollBind).Should(Equal(domain.Succeeded))
+
+					spec, err := broker.GetBinding(ctx, "some-instance-id", "binding-id", domain.FetchBindingDetails{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(spec.VolumeMounts).To(HaveLen(1))
+					Expect(spec.VolumeMounts[0].Device.MountConfig).To(HaveKeyWithValue("uid", "1000"))
+				})
+
+				It("does not deprovision the instance from under a bind in progress", func() {
+					release = make(chan struct{})
+
+					_, err := broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, true)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, err = broker.Deprovision(ctx, "some-instance-id", domain.DeprovisionDetails{}, true)
+					Expect(err).To(Equal(apiresponses.ErrConcurrentInstanceAccess))
+
+					close(release)
+					Eventually(pollBind).Should(Equal(domain.Succeeded))
+
+					_, err = broker.Deprovision(ctx, "some-instance-id", domain.DeprovisionDetails{}, true)
+					Expect(err).To(MatchError("service instance still has bindings: ['binding-id']"))
+				})
+
+				It("binds synchronously when the platform does not allow async", func() {
+					binding, err := broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, false)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(binding.IsAsync).To(BeFalse())
+					Expect(binding.VolumeMounts).To(HaveLen(1))
+				})
+
+				It("forgets the operation on unbind", func() {
+					_, err := broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, true)
+					Expect(err).NotTo(HaveOccurred())
+					Eventually(pollBind).Should(Equal(domain.Succeeded))
+
+					_, err = broker.Unbind(ctx, "some-instance-id", "binding-id", domain.UnbindDetails{}, false)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(instances).To(HaveLen(1))
+					Expect(instances).To(HaveKey("some-instance-id"))
+				})
+
+				It("forgets the operation once the binding is created synchronously", func() {
+					fakeStore.CreateBindingDetailsReturns(errors.New("badness"))
+					fakeStore.CreateBindingDetailsStub = nil
+
+					_, err := broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, true)
+					Expect(err).NotTo(HaveOccurred())
+					Eventually(pollBind).Should(Equal(domain.Failed))
+
+					fakeStore.CreateBindingDetailsStub = func(id string, details domain.BindDetails) error {
+						storeLock.Lock()
+						defer storeLock.Unlock()
+						bindings[id] = details
+						return nil
+					}
+
+					_, err = broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, false)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(pollBind()).To(Equal(domain.Succeeded))
+				})
+			})
+
+			Context(".LastOperation", func() {
+				It("errors on unrecognized operation data", func() {
+					_, err := broker.LastOperation(ctx, "some-instance-id", domain.PollDetails{OperationData: "something"})
+					Expect(err).To(MatchError("unrecognized operationData"))
+				})
+
+				It("reports instances provisioned synchronously as succeeded", func() {
+					instances["some-instance-id"] = brokerstore.ServiceInstance{}
+					Expect(pollProvision()).To(Equal(domain.Succeeded))
+				})
+
+				It("errors when the instance does not exist", func() {
+					_, err := broker.LastOperation(ctx, "some-instance-id", domain.PollDetails{OperationData: "provision"})
+					Expect(err).To(Equal(apiresponses.ErrInstanceDoesNotExist))
+				})
+			})
+
+			Context(".LastBindingOperation", func() {
+				It("errors on unrecognized operation data", func() {
+					_, err := broker.LastBindingOperation(ctx, "some-instance-id", "binding-id", domain.PollDetails{OperationData: "provision"})
+					Expect(err).To(MatchError("unrecognized operationData"))
+				})
+
+				It("reports bindings created synchronously as succeeded", func() {
+					bindings["binding-id"] = domain.BindDetails{}
+					Expect(pollBind()).To(Equal(domain.Succeeded))
+				})
+
+				It("errors when the binding does not exist", func() {
+					_, err := broker.LastBindingOperation(ctx, "some-instance-id", "binding-id", domain.PollDetails{OperationData: "bind"})
+					Expect(err).To(Equal(apiresponses.ErrBindingDoesNotExist))
+				})
+			})
+		})
+
+		Context("when backed by the in-memory store", func() {
+			var store *localstore.MemoryStore
+
+			BeforeEach(func() {
+				store = localstore.NewMemoryStore()
+				broker = existingvolumebroker.New(
+					existingvolumebroker.BrokerTypeNFS,
+					logger,
+					fakeServices,
+					fakeOs,
+					nil,
+					store,
+					configMask,
+				)
+			})
+
+			It("manages the lifecycle of an instance and its bindings", func() {
+				_, err := broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+					ServiceID:     "nfs-service-id",
+					PlanID:        "Existing",
+					RawParameters: json.RawMessage(`{"share":"server/some-share"}`),
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = broker.Update(ctx, "some-instance-id", domain.UpdateDetails{
+					RawParameters: json.RawMessage(`{"uid":"1000"}`),
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				instance, err := broker.GetInstance(ctx, "some-instance-id", domain.FetchInstanceDetails{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(instance.Parameters).To(Equal(map[string]interface{}{"share": "server/some-share", "uid": "1000"}))
+
+				bindDetails := domain.BindDetails{
+					AppGUID:       "guid",
+					RawParameters: json.RawMessage(`{"mount":"/var/vcap/data/mount"}`),
+				}
+				binding, err := broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				fetchedBinding, err := broker.GetBinding(ctx, "some-instance-id", "binding-id", domain.FetchBindingDetails{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fetchedBinding.VolumeMounts).To(Equal(binding.VolumeMounts))
+
+				_, err = broker.Deprovision(ctx, "some-instance-id", domain.DeprovisionDetails{}, false)
+				Expect(err).To(MatchError("service instance still has bindings: ['binding-id']"))
+
+				_, err = broker.Unbind(ctx, "some-instance-id", "binding-id", domain.UnbindDetails{}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = broker.Deprovision(ctx, "some-instance-id", domain.DeprovisionDetails{}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = broker.GetInstance(ctx, "some-instance-id", domain.FetchInstanceDetails{})
+				Expect(err).To(Equal(apiresponses.ErrInstanceDoesNotExist))
+			})
+
+			It("describes a binding as it was given after the instance is updated", func() {
+				_, err := broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+					ServiceID:     "nfs-service-id",
+					PlanID:        "Existing",
+					RawParameters: json.RawMessage(`{"share":"server/some-share","uid":"1000"}`),
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				binding, err := broker.Bind(ctx, "some-instance-id", "binding-id", domain.BindDetails{
+					AppGUID:       "guid",
+					RawParameters: json.RawMessage(`{}`),
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = broker.Update(ctx, "some-instance-id", domain.UpdateDetails{
+					RawParameters: json.RawMessage(`{"uid":"2000"}`),
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				fetchedBinding, err := broker.GetBinding(ctx, "some-instance-id", "binding-id", domain.FetchBindingDetails{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fetchedBinding.VolumeMounts).To(Equal(binding.VolumeMounts))
+				Expect(fetchedBinding.VolumeMounts[0].Device.MountConfig).To(HaveKeyWithValue("uid", "1000"))
+			})
+
+			It("keeps the bindings of an instance to that instance", func() {
+				for _, instanceID := range []string{"some-instance-id", "other-instance-id"} {
+					_, err := broker.Provision(ctx, instanceID, domain.ProvisionDetails{
+						ServiceID:     "nfs-service-id",
+						PlanID:        "Existing",
+						RawParameters: json.RawMessage(`{"share":"server/some-share"}`),
+					}, false)
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				bindDetails := domain.BindDetails{AppGUID: "guid", RawParameters: json.RawMessage(`{}`)}
+				_, err := broker.Bind(ctx, "some-instance-id", "binding-id", bindDetails, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = broker.Bind(ctx, "other-instance-id", "binding-id", bindDetails, false)
+				Expect(err).To(Equal(apiresponses.ErrBindingAlreadyExists))
+
+				_, err = broker.GetBinding(ctx, "other-instance-id", "binding-id", domain.FetchBindingDetails{})
+				Expect(err).To(Equal(apiresponses.ErrBindingNotFound))
+
+				_, err = broker.Unbind(ctx, "other-instance-id", "binding-id", domain.UnbindDetails{}, false)
+				Expect(err).To(Equal(apiresponses.ErrBindingDoesNotExist))
+
+				_, err = broker.Deprovision(ctx, "other-instance-id", domain.DeprovisionDetails{}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = broker.GetBinding(ctx, "some-instance-id", "binding-id", domain.FetchBindingDetails{})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			Context("when instances were provisioned before their bindings were recorded", func() {
+				BeforeEach(func() {
+					Expect(store.CreateInstanceDetails("legacy-instance-id", brokerstore.ServiceInstance{
+						ServiceID:          "nfs-service-id",
+						PlanID:             "Existing",
+						ServiceFingerPrint: map[string]interface{}{existingvolumebroker.SHARE_KEY: "server/some-share"},
+					})).To(Succeed())
+					Expect(store.CreateBindingDetails("legacy-binding-id", domain.BindDetails{
+						AppGUID:   "guid",
+						ServiceID: "nfs-service-id",
+						PlanID:    "Existing",
+					})).To(Succeed())
+				})
+
+				DescribeTable("refuses to deprovision them while bindings that may be theirs remain",
+					func(policy existingvolumebroker.DeprovisionPolicy) {
+						broker.(*existingvolumebroker.Broker).DeprovisionPolicy = policy
+
+						_, err := broker.Deprovision(ctx, "legacy-instance-id", domain.DeprovisionDetails{}, false)
+						Expect(err).To(MatchError("service instance may still have bindings: ['legacy-binding-id']"))
+						Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(409))
+
+						_, err = store.RetrieveBindingDetails("legacy-binding-id")
+						Expect(err).NotTo(HaveOccurred())
+
+						_, err = broker.Unbind(ctx, "legacy-instance-id", "legacy-binding-id", domain.UnbindDetails{}, false)
+						Expect(err).NotTo(HaveOccurred())
+
+						_, err = broker.Deprovision(ctx, "legacy-instance-id", domain.DeprovisionDetails{}, false)
+						Expect(err).NotTo(HaveOccurred())
+					},
+					Entry("refusing", existingvolumebroker.DeprovisionPolicyRefuse),
+					Entry("cascading", existingvolumebroker.DeprovisionPolicyCascade),
+				)
+
+				It("still deprovisions instances provisioned since", func() {
+					_, err := broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+						ServiceID:     "nfs-service-id",
+						PlanID:        "Existing",
+						RawParameters: json.RawMessage(`{"share":"server/some-share"}`),
+					}, false)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, err = broker.Deprovision(ctx, "some-instance-id", domain.DeprovisionDetails{}, false)
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+
+			It("does not list the state of operations as instances", func() {
+				broker.(*existingvolumebroker.Broker).AsyncOperations = true
+
+				_, err := broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+					ServiceID:     "nfs-service-id",
+					PlanID:        "Existing",
+					RawParameters: json.RawMessage(`{"share":"server/some-share"}`),
+				}, true)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(func() domain.LastOperationState {
+					lastOperation, err := broker.LastOperation(ctx, "some-instance-id", domain.PollDetails{OperationData: "provision"})
+					Expect(err).NotTo(HaveOccurred())
+					return lastOperation.State
+				}).Should(Equal(domain.Succeeded))
+
+				instances, err := store.RetrieveAllInstanceDetails()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(instances).To(HaveLen(1))
+				Expect(instances).To(HaveKey("some-instance-id"))
+			})
+		})
+
+		Context("when plans have config masks of their own", func() {
+			BeforeEach(func() {
+				pinnedMask, err := vmo.NewMountOptsMask(
+					[]string{"source", "mount", "version"},
+					map[string]interface{}{"version": "4.1"},
+					map[string]string{"share": "source"},
+					[]string{},
+					[]string{"source"},
+				)
+				Expect(err).NotTo(HaveOccurred())
+
+				planBroker := existingvolumebroker.New(
+					existingvolumebroker.BrokerTypeNFS,
+					logger,
+					fakeServices,
+					fakeOs,
+					nil,
+					localstore.NewMemoryStore(),
+					configMask,
+				)
+				planBroker.PlanConfigMasks = map[string]vmo.MountOptsMask{"Pinned": pinnedMask}
+				broker = planBroker
+
+				for instanceID, planID := range map[string]string{"pinned-instance-id": "Pinned", "existing-instance-id": "Existing"} {
+					_, err = broker.Provision(ctx, instanceID, domain.ProvisionDetails{
+						ServiceID:     "nfs-service-id",
+						PlanID:        planID,
+						RawParameters: json.RawMessage(`{"share":"server/some-share"}`),
+					}, false)
+					Expect(err).NotTo(HaveOccurred())
+				}
+			})
+
+			bind := func(instanceID string, params string) (domain.Binding, error) {
+				return broker.Bind(ctx, instanceID, "binding-id-"+instanceID, domain.BindDetails{
+					AppGUID:       "guid",
+					RawParameters: json.RawMessage(params),
+				}, false)
+			}
+
+			It("binds with the mask of the plan of the instance", func() {
+				binding, err := bind("pinned-instance-id", `{}`)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.VolumeMounts[0].Device.MountConfig).To(HaveKeyWithValue("version", "4.1"))
+
+				_, err = bind("pinned-instance-id", `{"uid":"1000"}`)
+				Expect(err).To(MatchError(ContainSubstring("Not allowed options: uid")))
+			})
+
+			It("binds instances of other plans with the default mask", func() {
+				binding, err := bind("existing-instance-id", `{"uid":"1000"}`)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.VolumeMounts[0].Device.MountConfig).To(HaveKeyWithValue("uid", "1000"))
+				Expect(binding.VolumeMounts[0].Device.MountConfig).NotTo(HaveKey("version"))
+			})
+
+			It("describes a binding as it was given after the plan of the instance changes", func() {
+				binding, err := bind("existing-instance-id", `{"uid":"1000"}`)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = broker.Update(ctx, "existing-instance-id", domain.UpdateDetails{PlanID: "Pinned"}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				fetchedBinding, err := broker.GetBinding(ctx, "existing-instance-id", "binding-id-existing-instance-id", domain.FetchBindingDetails{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fetchedBinding.VolumeMounts).To(Equal(binding.VolumeMounts))
+			})
+
+			It("validates an update against the mask of the new plan", func() {
+				_, err := broker.Update(ctx, "existing-instance-id", domain.UpdateDetails{
+					RawParameters: json.RawMessage(`{"uid":"1000"}`),
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = broker.Update(ctx, "existing-instance-id", domain.UpdateDetails{PlanID: "Pinned"}, false)
+				Expect(err).To(MatchError(ContainSubstring("Not allowed options: uid")))
+				Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+			})
+		})
+
+		Context("when instances are read-only", func() {
+			BeforeEach(func() {
+				readOnlyBroker := existingvolumebroker.New(
+					existingvolumebroker.BrokerTypeNFS,
+					logger,
+					fakeServices,
+					fakeOs,
+					nil,
+					localstore.NewMemoryStore(),
+					configMask,
+				)
+				readOnlyBroker.ReadOnlyPlans = []string{"ReadOnly"}
+				broker = readOnlyBroker
+
+				for instanceID, details := range map[string]domain.ProvisionDetails{
+					"read-only-plan-instance-id": {PlanID: "ReadOnly", RawParameters: json.RawMessage(`{"share":"server/some-share"}`)},
+					"read-only-instance-id":      {PlanID: "Existing", RawParameters: json.RawMessage(`{"share":"server/some-share","readonly":true}`)},
+					"read-write-instance-id":     {PlanID: "Existing", RawParameters: json.RawMessage(`{"share":"server/some-share"}`)},
+					"ro-instance-id":             {PlanID: "Existing", RawParameters: json.RawMessage(`{"share":"server/some-share","ro":true}`)},
+				} {
+					details.ServiceID = "nfs-service-id"
+					_, err := broker.Provision(ctx, instanceID, details, false)
+					Expect(err).NotTo(HaveOccurred())
+				}
+			})
+
+			bind := func(instanceID string, params string) (domain.Binding, error) {
+				return broker.Bind(ctx, instanceID, "binding-id-"+instanceID, domain.BindDetails{
+					AppGUID:       "guid",
+					RawParameters: json.RawMessage(params),
+				}, false)
+			}
+
+			DescribeTable("binds them read-only",
+				func(instanceID string, params string) {
+					binding, err := bind(instanceID, params)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(binding.VolumeMounts[0].Mode).To(Equal("r"))
+					Expect(binding.VolumeMounts[0].Device.MountConfig).To(HaveKeyWithValue("ro", "true"))
+				},
+				Entry("given a read-only plan", "read-only-plan-instance-id", `{}`),
+				Entry("given a read-only plan and readonly", "read-only-plan-instance-id", `{"readonly":true}`),
+				Entry("given an instance provisioned read-only", "read-only-instance-id", `{}`),
+				Entry("given an instance provisioned with the option readonly maps to", "ro-instance-id", `{}`),
+				Entry("given a read-only plan and the option readonly maps to", "read-only-plan-instance-id", `{"ro":true}`),
+			)
+
+			It("gives the same mount configuration every time", func() {
+				for i := 0; i < 10; i++ {
+					binding, err := broker.Bind(ctx, "read-only-instance-id", fmt.Sprintf("binding-id-%d", i), domain.BindDetails{
+						AppGUID:       fmt.Sprintf("guid-%d", i),
+						RawParameters: json.RawMessage(`{"ro":"true"}`),
+					}, false)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(binding.VolumeMounts[0].Device.MountConfig).To(HaveKeyWithValue("ro", "true"))
+				}
+			})
+
+			DescribeTable("refuses to bind them read-write",
+				func(instanceID string, params string) {
+					_, err := bind(instanceID, params)
+					Expect(err).To(MatchError("service instance is read-only and cannot be bound read-write"))
+					Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(403))
+				},
+				Entry("given a read-only plan", "read-only-plan-instance-id", `{"readonly":false}`),
+				Entry("given an instance provisioned read-only", "read-only-instance-id", `{"readonly":false}`),
+				Entry("given the option readonly maps to", "read-only-plan-instance-id", `{"ro":false}`),
+				Entry("given an instance provisioned with the option readonly maps to", "ro-instance-id", `{"ro":"false"}`),
+			)
+
+			DescribeTable("refuses updates that make them read-write",
+				func(params string) {
+					_, err := broker.Update(ctx, "read-only-instance-id", domain.UpdateDetails{
+						RawParameters: json.RawMessage(params),
+					}, false)
+					Expect(err).To(MatchError("update configuration cannot make a read-only service instance read-write"))
+					Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(422))
+
+					binding, err := bind("read-only-instance-id", `{}`)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(binding.VolumeMounts[0].Mode).To(Equal("r"))
+				},
+				Entry("removing readonly", `{"readonly":null}`),
+				Entry("setting readonly to false", `{"readonly":false}`),
+				Entry("setting the option readonly maps to false", `{"ro":false}`),
+			)
+
+			It("refuses updates that remove the option readonly maps to", func() {
+				_, err := broker.Update(ctx, "ro-instance-id", domain.UpdateDetails{
+					RawParameters: json.RawMessage(`{"ro":null}`),
+				}, false)
+				Expect(err).To(MatchError("update configuration cannot make a read-only service instance read-write"))
+			})
+
+			It("refuses readonly values other than true", func() {
+				_, err := bind("read-write-instance-id", `{"readonly":"false"}`)
+				Expect(err).To(MatchError(`Invalid ro parameter value: "false"`))
+				Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+			})
+
+			It("allows updates that make instances read-only", func() {
+				_, err := broker.Update(ctx, "read-write-instance-id", domain.UpdateDetails{
+					RawParameters: json.RawMessage(`{"readonly":true}`),
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				binding, err := bind("read-write-instance-id", `{}`)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.VolumeMounts[0].Mode).To(Equal("r"))
+			})
+
+			It("binds other instances read-write by default", func() {
+				binding, err := bind("read-write-instance-id", `{}`)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.VolumeMounts[0].Mode).To(Equal("rw"))
+				Expect(binding.VolumeMounts[0].Device.MountConfig).NotTo(HaveKey("ro"))
+
+				binding, err = broker.Bind(ctx, "read-write-instance-id", "other-binding-id", domain.BindDetails{
+					AppGUID:       "other-guid",
+					RawParameters: json.RawMessage(`{"readonly":true}`),
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(binding.VolumeMounts[0].Mode).To(Equal("r"))
 			})
 		})
 	})
@@ -0,0 +1,67 @@
+package existingvolumebroker
+
+import (
+	"context"
+	"sync"
+)
+
+// keyedLock provides mutual exclusion per key, so that operations on unrelated
+// service instances do not serialize behind one another. Operations on bindings
+// take the lock of their parent instance and, for bindings for an app, the lock
+// of the app after it.
+type keyedLock struct {
+	mutex sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	token   chan struct{}
+	waiters int
+}
+
+func newKeyedLock() *keyedLock {
+	return &keyedLock{locks: map[string]*keyLock{}}
+}
+
+// Lock blocks until the lock for key is acquired, or until ctx is done, in which
+// case the context error is returned and the lock is not held.
+func (k *keyedLock) Lock(ctx context.Context, key string) error {
+	k.mutex.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyLock{token: make(chan struct{}, 1)}
+		k.locks[key] = l
+	}
+	l.waiters++
+	k.mutex.Unlock()
+
+	select {
+	case l.token <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		k.release(key, l)
+		return ctx.Err()
+	}
+}
+
+func (k *keyedLock) Unlock(key string) {
+	k.mutex.Lock()
+	l, ok := k.locks[key]
+	k.mutex.Unlock()
+	if !ok {
+		panic("unlock of unlocked key " + key)
+	}
+
+	<-l.token
+	k.release(key, l)
+}
+
+func (k *keyedLock) release(key string, l *keyLock) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	l.waiters--
+	if l.waiters == 0 {
+		delete(k.locks, key)
+	}
+}
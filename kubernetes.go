@@ -0,0 +1,150 @@
+package existingvolumebroker
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	vmou "code.cloudfoundry.org/volume-mount-options/utils"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+// kubernetesNominalCapacity is the capacity given to persistent volumes.
+// Kubernetes requires one, but does not enforce it for shared file systems,
+// and the broker does not know the size of a share.
+const kubernetesNominalCapacity = "1Gi"
+
+// KubernetesVolume is what the persistent volume of a binding on Kubernetes is
+// rendered from.
+type KubernetesVolume struct {
+	// ID is the volume ID of the binding, which also names the volume.
+	ID    string
+	Share Share
+	// MountConfig is the mount configuration of the binding, without the
+	// source, the mount path, the read-only flag and secrets.
+	MountConfig map[string]interface{}
+	ReadOnly    bool
+}
+
+// kubernetesCredentials describes a binding to Kubernetes as a persistent
+// volume, which mounts the same share with the same options as the volume
+// mount Cloud Foundry would get. Secrets are left out, so shares of protocols
+// that need them to mount, such as SMB, are not described to Kubernetes.
+func (b *Broker) kubernetesCredentials(instanceDetails brokerstore.ServiceInstance, bindDetails domain.BindDetails, volumeMount domain.VolumeMount) (map[string]interface{}, error) {
+	sourcer, err := b.kubernetesVolumeSourcer()
+	if err != nil {
+		return nil, err
+	}
+
+	bindShare, err := bindingShare(instanceDetails, bindDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	share, err := b.protocol.ParseShare(bindShare)
+	if err != nil {
+		return nil, err
+	}
+
+	volume := KubernetesVolume{
+		ID:          volumeMount.Device.VolumeId,
+		Share:       share,
+		MountConfig: map[string]interface{}{},
+		ReadOnly:    volumeMount.Mode == "r",
+	}
+	for k, v := range volumeMount.Device.MountConfig {
+		if containsString([]string{SOURCE_KEY, "mount", "readonly", "ro"}, k) || b.isSensitive(k) {
+			continue
+		}
+		volume.MountConfig[k] = v
+	}
+
+	source, mountOptions := sourcer.KubernetesVolumeSource(volume)
+
+	accessMode := "ReadWriteMany"
+	if volume.ReadOnly {
+		accessMode = "ReadOnlyMany"
+	}
+
+	spec := map[string]interface{}{
+		"capacity":                      map[string]interface{}{"storage": kubernetesNominalCapacity},
+		"accessModes":                   []string{accessMode},
+		"persistentVolumeReclaimPolicy": "Retain",
+	}
+	if len(mountOptions) > 0 {
+		spec["mountOptions"] = mountOptions
+	}
+	for k, v := range source {
+		spec[k] = v
+	}
+
+	return map[string]interface{}{
+		SHARE_KEY: share.Canonical,
+		"persistent_volume": map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "PersistentVolume",
+			"metadata":   map[string]interface{}{"name": volume.ID},
+			"spec":       spec,
+		},
+	}, nil
+}
+
+// kubernetesVolumeSourcer returns the protocol as a KubernetesVolumeSourcer,
+// or an error when Kubernetes has no way to mount its shares.
+func (b *Broker) kubernetesVolumeSourcer() (KubernetesVolumeSourcer, error) {
+	sourcer, ok := b.protocol.(KubernetesVolumeSourcer)
+	if !ok {
+		err := fmt.Errorf("bindings on kubernetes are not supported for shares mounted by %s", b.protocol.DriverName())
+		return nil, apiresponses.NewFailureResponse(err, http.StatusUnprocessableEntity, "unsupported-platform")
+	}
+	return sourcer, nil
+}
+
+// kubernetesMountOptions turns a mount configuration into mount options,
+// renaming keys the kernel knows by another name and leaving out the excluded
+// ones.
+func kubernetesMountOptions(mountConfig map[string]interface{}, renamed map[string]string, excluded ...string) []string {
+	options := []string{}
+	for k, v := range mountConfig {
+		if containsString(excluded, k) {
+			continue
+		}
+		if name, ok := renamed[k]; ok {
+			k = name
+		}
+		options = append(options, fmt.Sprintf("%s=%s", k, vmou.InterfaceToString(v)))
+	}
+	sort.Strings(options)
+	return options
+}
+
+// nfsDriverOptions are options of the nfsv3driver and its mapfs and fuse-nfs
+// mounters rather than of the kernel, which would refuse to mount with them.
+var nfsDriverOptions = []string{
+	"uid", "gid", "username", "password",
+	"allow_other", "allow_root", "auto_cache", "cache", "default_permissions",
+	"dircache", "experimental", "fail_on_mount_failure", "fsname",
+	"multithread", "sloppy_mount",
+}
+
+// nfsKubernetesVolumeSource describes an NFS share as an in-tree NFS volume.
+// The options implemented by the nfsv3driver are left out.
+func nfsKubernetesVolumeSource(volume KubernetesVolume) (map[string]interface{}, []string) {
+	server := volume.Share.Servers[0]
+	mountOptions := kubernetesMountOptions(volume.MountConfig, map[string]string{VERSION_KEY: "nfsvers"}, nfsDriverOptions...)
+	if server.Port != 0 {
+		mountOptions = append(mountOptions, "port="+strconv.Itoa(server.Port))
+		sort.Strings(mountOptions)
+	}
+
+	return map[string]interface{}{
+		"nfs": map[string]interface{}{
+			"server":   server.Host,
+			"path":     volume.Share.Path,
+			"readOnly": volume.ReadOnly,
+		},
+	}, mountOptions
+}
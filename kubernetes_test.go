@@ -0,0 +1,97 @@
+package existingvolumebroker_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+var _ = Describe("Kubernetes bindings", func() {
+	ctx := context.TODO()
+
+	provision := func(brokerType existingvolumebroker.BrokerType, allowed []string, share string) testBroker {
+		return provisionTestBroker(
+			brokerType,
+			lagertest.NewTestLogger("test-broker"),
+			testConfigMask(allowed...),
+			localstore.NewMemoryStore(),
+			`{"share":"`+share+`"}`,
+			"some-instance-id",
+		)
+	}
+
+	credentialsOf := func(binding domain.Binding, err error) map[string]interface{} {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(binding.VolumeMounts).To(BeEmpty())
+		return binding.Credentials.(map[string]interface{})
+	}
+
+	It("describes NFS shares as NFS persistent volumes", func() {
+		broker := provision(existingvolumebroker.BrokerTypeNFS, []string{"source", "mount", "uid", "gid", "version", "ro"}, "server:2049/export")
+
+		credentials := credentialsOf(broker.bindKubernetes("some-instance-id", "binding-id", `{"uid":"1000","gid":"1000","version":"4.1","mount":"/var/vcap/data/export"}`))
+		Expect(credentials).To(HaveKeyWithValue("share", "server:2049/export"))
+
+		persistentVolume := credentials["persistent_volume"].(map[string]interface{})
+		Expect(persistentVolume).To(HaveKeyWithValue("apiVersion", "v1"))
+		Expect(persistentVolume).To(HaveKeyWithValue("kind", "PersistentVolume"))
+		Expect(persistentVolume["metadata"]).To(HaveKeyWithValue("name", HavePrefix("some-instance-id-")))
+		Expect(persistentVolume["spec"]).To(Equal(map[string]interface{}{
+			"capacity":                      map[string]interface{}{"storage": "1Gi"},
+			"accessModes":                   []string{"ReadWriteMany"},
+			"persistentVolumeReclaimPolicy": "Retain",
+			"mountOptions":                  []string{"nfsvers=4.1", "port=2049"},
+			"nfs": map[string]interface{}{
+				"server":   "server",
+				"path":     "/export",
+				"readOnly": false,
+			},
+		}))
+	})
+
+	It("describes NFSv4 shares as NFS persistent volumes", func() {
+		broker := provision(existingvolumebroker.BrokerTypeNFSv4, []string{"source", "version"}, "server:/export")
+
+		credentials := credentialsOf(broker.bindKubernetes("some-instance-id", "binding-id", `{"minorversion":"1","sec":"krb5"}`))
+		spec := credentials["persistent_volume"].(map[string]interface{})["spec"].(map[string]interface{})
+		Expect(spec["mountOptions"]).To(Equal([]string{"minorversion=1", "nfsvers=4", "sec=krb5"}))
+		Expect(spec["nfs"]).To(HaveKeyWithValue("path", "/export"))
+	})
+
+	It("leaves the options of the nfsv3driver out of the mount options", func() {
+		broker := provision(existingvolumebroker.BrokerTypeNFS, []string{"source", "uid", "allow_root", "sloppy_mount", "auto_cache", "nconnect"}, "server/export")
+
+		credentials := credentialsOf(broker.bindKubernetes("some-instance-id", "binding-id", `{"uid":"1000","allow_root":true,"sloppy_mount":true,"auto_cache":true,"nconnect":"4"}`))
+		spec := credentials["persistent_volume"].(map[string]interface{})["spec"].(map[string]interface{})
+		Expect(spec["mountOptions"]).To(Equal([]string{"nconnect=4"}))
+	})
+
+	DescribeTable("refuses bindings for shares Kubernetes cannot mount",
+		func(brokerType existingvolumebroker.BrokerType, allowed []string, share string, params string, driver string) {
+			broker := provision(brokerType, allowed, share)
+
+			_, err := broker.bindKubernetes("some-instance-id", "binding-id", params)
+			Expect(err).To(MatchError("bindings on kubernetes are not supported for shares mounted by " + driver))
+			Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(422))
+
+			_, err = broker.GetBinding(ctx, "some-instance-id", "binding-id", domain.FetchBindingDetails{})
+			Expect(err).To(Equal(apiresponses.ErrBindingNotFound))
+		},
+		Entry("CephFS", existingvolumebroker.BrokerTypeCephFS, []string{"source"}, "mon1:6789:/subvolume", `{"name":"app-client","secret":"QVFEbWFueWJ5dGVz"}`, "cephdriver"),
+		Entry("SMB", existingvolumebroker.BrokerTypeSMB, []string{"source", "username", "password"}, "//server/share", `{"username":"some-user","password":"some-password"}`, "smbdriver"),
+	)
+
+	It("does not require service keys to be enabled", func() {
+		broker := provision(existingvolumebroker.BrokerTypeNFS, []string{"source"}, "server/export")
+		Expect(broker.ServiceKeys).To(BeFalse())
+
+		credentials := credentialsOf(broker.bindKubernetes("some-instance-id", "binding-id", `{}`))
+		Expect(credentials).To(HaveKey("persistent_volume"))
+	})
+})
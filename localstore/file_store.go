@@ -0,0 +1,110 @@
+package localstore
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+)
+
+// FileStore keeps instances and bindings in memory and persists them to a
+// single JSON file on Save. The file is replaced atomically, so a crash while
+// saving leaves the previous contents intact.
+type FileStore struct {
+	*MemoryStore
+
+	path string
+
+	// saveMutex orders concurrent saves, so that the last snapshot taken is
+	// the last one written
+	saveMutex sync.Mutex
+}
+
+type storeContents struct {
+	Instances map[string]brokerstore.ServiceInstance `json:"instances"`
+	Bindings  map[string]domain.BindDetails          `json:"bindings"`
+	Records   map[string]map[string]interface{}      `json:"records,omitempty"`
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+	}
+}
+
+// Restore replaces the contents of the store with those of the file. A
+// missing file restores an empty store.
+func (s *FileStore) Restore(logger lager.Logger) error {
+	logger = logger.Session("restore", lager.Data{"path": s.path})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	contents := storeContents{}
+
+	data, err := os.ReadFile(s.path)
+	switch {
+	case os.IsNotExist(err):
+		logger.Info("no-state-file")
+	case err != nil:
+		logger.Error("failed-to-read-state-file", err)
+		return err
+	default:
+		if err := json.Unmarshal(data, &contents); err != nil {
+			logger.Error("failed-to-parse-state-file", err)
+			return err
+		}
+	}
+
+	s.replace(contents)
+	return nil
+}
+
+// Save writes the contents of the store to a temporary file next to the state
+// file, and renames it over the state file once it is fully written.
+func (s *FileStore) Save(logger lager.Logger) error {
+	logger = logger.Session("save", lager.Data{"path": s.path})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+
+	data, err := json.Marshal(s.contents())
+	if err != nil {
+		logger.Error("failed-to-marshal-state", err)
+		return err
+	}
+
+	if err := writeFileAtomically(s.path, data); err != nil {
+		logger.Error("failed-to-write-state-file", err)
+		return err
+	}
+	return nil
+}
+
+func writeFileAtomically(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,124 @@
+package localstore_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/existingvolumebroker/localstore/storetest"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("FileStore", func() {
+	var (
+		logger    *lagertest.TestLogger
+		statePath string
+		store     *localstore.FileStore
+
+		instance brokerstore.ServiceInstance
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("file-store")
+		statePath = filepath.Join(GinkgoT().TempDir(), "state.json")
+		store = localstore.NewFileStore(statePath)
+
+		instance = brokerstore.ServiceInstance{
+			ServiceID:          "service-id",
+			PlanID:             "plan-id",
+			OrganizationGUID:   "org-guid",
+			SpaceGUID:          "space-guid",
+			ServiceFingerPrint: map[string]interface{}{"share": "server:/some-share", "uid": 1000},
+		}
+	})
+
+	storetest.ItBehavesLikeAStore(
+		func() brokerstore.Store { return localstore.NewFileStore(statePath) },
+		func(brokerstore.Store) brokerstore.Store { return localstore.NewFileStore(statePath) },
+	)
+
+	Context("persistence", func() {
+		It("restores an empty store when there is no state file", func() {
+			Expect(store.Restore(logger)).To(Succeed())
+			Expect(logger.Buffer()).To(gbytes.Say("no-state-file"))
+
+			instances, err := store.RetrieveAllInstanceDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).To(BeEmpty())
+		})
+
+		It("restores the records of the broker apart from instances", func() {
+			Expect(store.CreateRecord("record-id", map[string]interface{}{"state": "in progress"})).To(Succeed())
+			Expect(store.Save(logger)).To(Succeed())
+
+			restored := localstore.NewFileStore(statePath)
+			Expect(restored.Restore(logger)).To(Succeed())
+
+			record, err := restored.RetrieveRecord("record-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(record).To(Equal(map[string]interface{}{"state": "in progress"}))
+
+			instances, err := restored.RetrieveAllInstanceDetails()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).To(BeEmpty())
+		})
+
+		It("replaces the contents of the store on restore", func() {
+			Expect(store.Save(logger)).To(Succeed())
+			Expect(store.CreateInstanceDetails("instance-id", instance)).To(Succeed())
+
+			Expect(store.Restore(logger)).To(Succeed())
+
+			_, err := store.RetrieveInstanceDetails("instance-id")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("writes the state file readable only by its owner and leaves no temporary files behind", func() {
+			Expect(store.CreateInstanceDetails("instance-id", instance)).To(Succeed())
+			Expect(store.Save(logger)).To(Succeed())
+			Expect(store.Save(logger)).To(Succeed())
+
+			info, err := os.Stat(statePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			entries, err := os.ReadDir(filepath.Dir(statePath))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+
+		It("keeps the previous state file when saving fails", func() {
+			Expect(store.CreateInstanceDetails("instance-id", instance)).To(Succeed())
+			Expect(store.Save(logger)).To(Succeed())
+			previous, err := os.ReadFile(statePath)
+			Expect(err).NotTo(HaveOccurred())
+
+			if os.Geteuid() == 0 {
+				Skip("directory permissions do not apply to root")
+			}
+
+			Expect(store.CreateInstanceDetails("other-instance-id", instance)).To(Succeed())
+			Expect(os.Chmod(filepath.Dir(statePath), 0500)).To(Succeed())
+			defer os.Chmod(filepath.Dir(statePath), 0700)
+
+			Expect(store.Save(logger)).NotTo(Succeed())
+			Expect(logger.Buffer()).To(gbytes.Say("failed-to-write-state-file"))
+
+			current, err := os.ReadFile(statePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(current).To(Equal(previous))
+		})
+
+		It("errors on a corrupt state file", func() {
+			Expect(os.WriteFile(statePath, []byte("not json"), 0600)).To(Succeed())
+
+			Expect(store.Restore(logger)).NotTo(Succeed())
+			Expect(logger.Buffer()).To(gbytes.Say("failed-to-parse-state-file"))
+		})
+
+	})
+})
@@ -0,0 +1,13 @@
+package localstore_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestLocalstore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Localstore Suite")
+}
@@ -0,0 +1,230 @@
+package localstore
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+)
+
+// MemoryStore keeps instances and bindings in memory only, so its contents
+// are lost when the broker stops. The records of the broker are kept apart
+// from instances, so they are never listed as instances.
+type MemoryStore struct {
+	mutex     sync.RWMutex
+	instances map[string]brokerstore.ServiceInstance
+	bindings  map[string]domain.BindDetails
+	records   map[string]map[string]interface{}
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		instances: map[string]brokerstore.ServiceInstance{},
+		bindings:  map[string]domain.BindDetails{},
+		records:   map[string]map[string]interface{}{},
+	}
+}
+
+func (s *MemoryStore) RetrieveInstanceDetails(id string) (brokerstore.ServiceInstance, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	details, ok := s.instances[id]
+	if !ok {
+		return brokerstore.ServiceInstance{}, instanceNotFound(id)
+	}
+	return normalizeInstance(details)
+}
+
+func (s *MemoryStore) RetrieveBindingDetails(id string) (domain.BindDetails, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	details, ok := s.bindings[id]
+	if !ok {
+		return domain.BindDetails{}, bindingNotFound(id)
+	}
+	return normalizeBinding(details)
+}
+
+func (s *MemoryStore) RetrieveAllInstanceDetails() (map[string]brokerstore.ServiceInstance, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	instances := map[string]brokerstore.ServiceInstance{}
+	for id, details := range s.instances {
+		normalized, err := normalizeInstance(details)
+		if err != nil {
+			return nil, err
+		}
+		instances[id] = normalized
+	}
+	return instances, nil
+}
+
+func (s *MemoryStore) RetrieveAllBindingDetails() (map[string]domain.BindDetails, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	bindings := map[string]domain.BindDetails{}
+	for id, details := range s.bindings {
+		normalized, err := normalizeBinding(details)
+		if err != nil {
+			return nil, err
+		}
+		bindings[id] = normalized
+	}
+	return bindings, nil
+}
+
+func (s *MemoryStore) CreateInstanceDetails(id string, details brokerstore.ServiceInstance) error {
+	normalized, err := normalizeInstance(details)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.instances[id] = normalized
+	return nil
+}
+
+func (s *MemoryStore) CreateBindingDetails(id string, details domain.BindDetails) error {
+	normalized, err := normalizeBinding(details)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.bindings[id] = normalized
+	return nil
+}
+
+func (s *MemoryStore) DeleteInstanceDetails(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.instances[id]; !ok {
+		return instanceNotFound(id)
+	}
+	delete(s.instances, id)
+	return nil
+}
+
+func (s *MemoryStore) DeleteBindingDetails(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.bindings[id]; !ok {
+		return bindingNotFound(id)
+	}
+	delete(s.bindings, id)
+	return nil
+}
+
+func (s *MemoryStore) RetrieveRecord(id string) (map[string]interface{}, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return nil, recordNotFound(id)
+	}
+	return normalizeRecord(record)
+}
+
+func (s *MemoryStore) CreateRecord(id string, record map[string]interface{}) error {
+	normalized, err := normalizeRecord(record)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.records[id] = normalized
+	return nil
+}
+
+func (s *MemoryStore) DeleteRecord(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.records[id]; !ok {
+		return recordNotFound(id)
+	}
+	delete(s.records, id)
+	return nil
+}
+
+func (s *MemoryStore) IsInstanceConflict(id string, details brokerstore.ServiceInstance) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	existing, ok := s.instances[id]
+	return ok && isInstanceConflict(existing, details)
+}
+
+func (s *MemoryStore) IsBindingConflict(id string, details domain.BindDetails) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	existing, ok := s.bindings[id]
+	return ok && isBindingConflict(existing, details)
+}
+
+func (s *MemoryStore) Restore(logger lager.Logger) error {
+	return nil
+}
+
+func (s *MemoryStore) Save(logger lager.Logger) error {
+	return nil
+}
+
+func (s *MemoryStore) Cleanup() error {
+	return nil
+}
+
+func (s *MemoryStore) contents() storeContents {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	contents := storeContents{
+		Instances: make(map[string]brokerstore.ServiceInstance, len(s.instances)),
+		Bindings:  make(map[string]domain.BindDetails, len(s.bindings)),
+		Records:   make(map[string]map[string]interface{}, len(s.records)),
+	}
+	for id, details := range s.instances {
+		contents.Instances[id] = details
+	}
+	for id, details := range s.bindings {
+		contents.Bindings[id] = details
+	}
+	for id, record := range s.records {
+		contents.Records[id] = record
+	}
+	return contents
+}
+
+func (s *MemoryStore) replace(contents storeContents) {
+	if contents.Instances == nil {
+		contents.Instances = map[string]brokerstore.ServiceInstance{}
+	}
+	if contents.Bindings == nil {
+		contents.Bindings = map[string]domain.BindDetails{}
+	}
+	if contents.Records == nil {
+		contents.Records = map[string]map[string]interface{}{}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.instances = contents.Instances
+	s.bindings = contents.Bindings
+	s.records = contents.Records
+}
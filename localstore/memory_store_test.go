@@ -0,0 +1,47 @@
+package localstore_test
+
+import (
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/existingvolumebroker/localstore/storetest"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ existingvolumebroker.RecordStore = localstore.NewMemoryStore()
+
+var _ = Describe("MemoryStore", func() {
+	storetest.ItBehavesLikeAStore(
+		func() brokerstore.Store { return localstore.NewMemoryStore() },
+		func(store brokerstore.Store) brokerstore.Store { return store },
+	)
+
+	It("errors when deleting missing details", func() {
+		store := localstore.NewMemoryStore()
+
+		Expect(store.DeleteInstanceDetails("instance-id")).To(MatchError("instance instance-id not found"))
+		Expect(store.DeleteBindingDetails("binding-id")).To(MatchError("binding binding-id not found"))
+	})
+
+	It("keeps records apart from instances", func() {
+		store := localstore.NewMemoryStore()
+
+		Expect(store.CreateRecord("record-id", map[string]interface{}{"uid": 1000})).To(Succeed())
+
+		record, err := store.RetrieveRecord("record-id")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record).To(Equal(map[string]interface{}{"uid": float64(1000)}))
+
+		_, err = store.RetrieveInstanceDetails("record-id")
+		Expect(err).To(HaveOccurred())
+		instances, err := store.RetrieveAllInstanceDetails()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instances).To(BeEmpty())
+
+		Expect(store.DeleteRecord("record-id")).To(Succeed())
+		_, err = store.RetrieveRecord("record-id")
+		Expect(err).To(MatchError("record record-id not found"))
+		Expect(store.DeleteRecord("record-id")).To(MatchError("record record-id not found"))
+	})
+})
@@ -0,0 +1,135 @@
+// Package localstore provides brokerstore.Store implementations that do not
+// depend on CredHub, so that a broker can run standalone.
+package localstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// NewStore returns a FileStore persisting to storePath when it is set, and
+// otherwise the store configured by brokerstore.NewStore.
+func NewStore(
+	logger lager.Logger,
+	storePath,
+	credhubURL,
+	credhubCACert,
+	clientID,
+	clientSecret,
+	uaaCACert string,
+	storeID string,
+) brokerstore.Store {
+	if storePath != "" {
+		return NewFileStore(storePath)
+	}
+	return brokerstore.NewStore(logger, credhubURL, credhubCACert, clientID, clientSecret, uaaCACert, storeID)
+}
+
+func instanceNotFound(id string) error {
+	return fmt.Errorf("instance %s not found", id)
+}
+
+func bindingNotFound(id string) error {
+	return fmt.Errorf("binding %s not found", id)
+}
+
+func recordNotFound(id string) error {
+	return fmt.Errorf("record %s not found", id)
+}
+
+// normalizeInstance round trips the instance through JSON, so that it reads
+// back the same whether or not it has been persisted in between, as it would
+// from CredHub.
+func normalizeInstance(details brokerstore.ServiceInstance) (brokerstore.ServiceInstance, error) {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return brokerstore.ServiceInstance{}, err
+	}
+
+	var normalized brokerstore.ServiceInstance
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return brokerstore.ServiceInstance{}, err
+	}
+	return normalized, nil
+}
+
+func normalizeBinding(details domain.BindDetails) (domain.BindDetails, error) {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return domain.BindDetails{}, err
+	}
+
+	var normalized domain.BindDetails
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return domain.BindDetails{}, err
+	}
+	return normalized, nil
+}
+
+func normalizeRecord(record map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+func isInstanceConflict(existing brokerstore.ServiceInstance, details brokerstore.ServiceInstance) bool {
+	normalized, err := normalizeInstance(details)
+	if err != nil {
+		return true
+	}
+	return !reflect.DeepEqual(existing, normalized)
+}
+
+// isBindingConflict follows the rules of the CredHub store, but compares
+// parameters as JSON unless the existing binding was stored with its
+// parameters replaced by a hash.
+func isBindingConflict(existing domain.BindDetails, details domain.BindDetails) bool {
+	if existing.AppGUID != details.AppGUID ||
+		existing.PlanID != details.PlanID ||
+		existing.ServiceID != details.ServiceID {
+		return true
+	}
+	if !reflect.DeepEqual(existing.BindResource, details.BindResource) {
+		return true
+	}
+
+	if len(existing.RawParameters) == 0 || len(details.RawParameters) == 0 {
+		return len(existing.RawParameters) != len(details.RawParameters)
+	}
+
+	var existingParams map[string]interface{}
+	if err := json.Unmarshal(existing.RawParameters, &existingParams); err != nil {
+		return true
+	}
+
+	if hash, ok := paramsHash(existingParams); ok {
+		return bcrypt.CompareHashAndPassword([]byte(hash), details.RawParameters) != nil
+	}
+
+	var params map[string]interface{}
+	if err := json.Unmarshal(details.RawParameters, &params); err != nil {
+		return true
+	}
+	return !reflect.DeepEqual(existingParams, params)
+}
+
+func paramsHash(params map[string]interface{}) (string, bool) {
+	if len(params) != 1 {
+		return "", false
+	}
+	hash, ok := params[brokerstore.HashKey].(string)
+	return hash, ok
+}
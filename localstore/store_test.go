@@ -0,0 +1,21 @@
+package localstore_test
+
+import (
+	"path/filepath"
+
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NewStore", func() {
+	It("returns a file store when a store path is configured", func() {
+		logger := lagertest.NewTestLogger("new-store")
+		statePath := filepath.Join(GinkgoT().TempDir(), "state.json")
+
+		store := localstore.NewStore(logger, statePath, "https://credhub.example.com", "", "", "", "", "store-id")
+		Expect(store).To(BeAssignableToTypeOf(&localstore.FileStore{}))
+		Expect(store.Restore(logger)).To(Succeed())
+	})
+})
@@ -0,0 +1,271 @@
+// Package storetest provides a conformance suite for brokerstore.Store
+// implementations, covering the behaviour the broker relies upon.
+package storetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ItBehavesLikeAStore registers the conformance specs in the current
+// container. newStore returns an empty store, and reopen returns a store over
+// the state saved by the given store, as a restarted broker would see it.
+// Stores without persistence can return the given store from reopen.
+func ItBehavesLikeAStore(newStore func() brokerstore.Store, reopen func(brokerstore.Store) brokerstore.Store) {
+	var (
+		logger *lagertest.TestLogger
+		store  brokerstore.Store
+
+		instance brokerstore.ServiceInstance
+		binding  domain.BindDetails
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("store-conformance")
+		store = newStore()
+
+		instance = brokerstore.ServiceInstance{
+			ServiceID:          "service-id",
+			PlanID:             "plan-id",
+			OrganizationGUID:   "org-guid",
+			SpaceGUID:          "space-guid",
+			ServiceFingerPrint: map[string]interface{}{"share": "server:/some-share", "uid": 1000},
+		}
+		binding = domain.BindDetails{
+			AppGUID:       "app-guid",
+			PlanID:        "plan-id",
+			ServiceID:     "service-id",
+			RawContext:    json.RawMessage(`{"instance_id":"instance-id"}`),
+			RawParameters: json.RawMessage(`{"uid":"1000","mount":"/data"}`),
+		}
+	})
+
+	It("retrieves what was created", func() {
+		Expect(store.CreateInstanceDetails("instance-id", instance)).To(Succeed())
+		Expect(store.CreateBindingDetails("binding-id", binding)).To(Succeed())
+
+		retrievedInstance, err := store.RetrieveInstanceDetails("instance-id")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retrievedInstance.ServiceID).To(Equal("service-id"))
+		Expect(retrievedInstance.PlanID).To(Equal("plan-id"))
+		Expect(retrievedInstance.OrganizationGUID).To(Equal("org-guid"))
+		Expect(retrievedInstance.SpaceGUID).To(Equal("space-guid"))
+		Expect(retrievedInstance.ServiceFingerPrint).To(Equal(map[string]interface{}{"share": "server:/some-share", "uid": float64(1000)}))
+
+		retrievedBinding, err := store.RetrieveBindingDetails("binding-id")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retrievedBinding.AppGUID).To(Equal("app-guid"))
+		Expect(retrievedBinding.PlanID).To(Equal("plan-id"))
+		Expect(retrievedBinding.ServiceID).To(Equal("service-id"))
+		Expect(retrievedBinding.RawParameters).To(MatchJSON(binding.RawParameters))
+		Expect(retrievedBinding.RawContext).To(MatchJSON(binding.RawContext))
+	})
+
+	It("retrieves legacy instances that only store a share", func() {
+		instance.ServiceFingerPrint = "server:/some-share"
+		Expect(store.CreateInstanceDetails("instance-id", instance)).To(Succeed())
+
+		retrievedInstance, err := store.RetrieveInstanceDetails("instance-id")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retrievedInstance.ServiceFingerPrint).To(Equal("server:/some-share"))
+	})
+
+	It("overwrites existing details on create", func() {
+		Expect(store.CreateInstanceDetails("instance-id", instance)).To(Succeed())
+		instance.PlanID = "other-plan-id"
+		Expect(store.CreateInstanceDetails("instance-id", instance)).To(Succeed())
+
+		retrievedInstance, err := store.RetrieveInstanceDetails("instance-id")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retrievedInstance.PlanID).To(Equal("other-plan-id"))
+	})
+
+	It("does not share state with the caller", func() {
+		Expect(store.CreateInstanceDetails("instance-id", instance)).To(Succeed())
+		instance.ServiceFingerPrint.(map[string]interface{})["share"] = "changed"
+
+		retrievedInstance, err := store.RetrieveInstanceDetails("instance-id")
+		Expect(err).NotTo(HaveOccurred())
+		retrievedInstance.ServiceFingerPrint.(map[string]interface{})["uid"] = "changed"
+
+		retrievedInstance, err = store.RetrieveInstanceDetails("instance-id")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retrievedInstance.ServiceFingerPrint).To(Equal(map[string]interface{}{"share": "server:/some-share", "uid": float64(1000)}))
+	})
+
+	It("errors when retrieving missing details", func() {
+		_, err := store.RetrieveInstanceDetails("instance-id")
+		Expect(err).To(HaveOccurred())
+		_, err = store.RetrieveBindingDetails("binding-id")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("deletes details", func() {
+		Expect(store.CreateInstanceDetails("instance-id", instance)).To(Succeed())
+		Expect(store.CreateBindingDetails("binding-id", binding)).To(Succeed())
+
+		Expect(store.DeleteInstanceDetails("instance-id")).To(Succeed())
+		Expect(store.DeleteBindingDetails("binding-id")).To(Succeed())
+
+		_, err := store.RetrieveInstanceDetails("instance-id")
+		Expect(err).To(HaveOccurred())
+		_, err = store.RetrieveBindingDetails("binding-id")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("retrieves all details", func() {
+		Expect(store.CreateInstanceDetails("instance-1", instance)).To(Succeed())
+		Expect(store.CreateInstanceDetails("instance-2", instance)).To(Succeed())
+		Expect(store.CreateBindingDetails("binding-1", binding)).To(Succeed())
+
+		instances, err := store.RetrieveAllInstanceDetails()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instances).To(HaveLen(2))
+		Expect(instances).To(HaveKey("instance-1"))
+		Expect(instances).To(HaveKey("instance-2"))
+
+		bindings, err := store.RetrieveAllBindingDetails()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bindings).To(HaveLen(1))
+		Expect(bindings["binding-1"].RawContext).To(MatchJSON(binding.RawContext))
+	})
+
+	Context("conflicts", func() {
+		BeforeEach(func() {
+			Expect(store.CreateInstanceDetails("instance-id", instance)).To(Succeed())
+			Expect(store.CreateBindingDetails("binding-id", binding)).To(Succeed())
+		})
+
+		It("does not conflict with missing or identical details", func() {
+			Expect(store.IsInstanceConflict("other-instance-id", instance)).To(BeFalse())
+			Expect(store.IsInstanceConflict("instance-id", instance)).To(BeFalse())
+
+			Expect(store.IsBindingConflict("other-binding-id", binding)).To(BeFalse())
+			Expect(store.IsBindingConflict("binding-id", binding)).To(BeFalse())
+		})
+
+		It("conflicts with different instance details", func() {
+			instance.ServiceFingerPrint = map[string]interface{}{"share": "server:/other-share"}
+			Expect(store.IsInstanceConflict("instance-id", instance)).To(BeTrue())
+		})
+
+		It("compares binding parameters as JSON", func() {
+			binding.RawParameters = json.RawMessage(`{ "mount": "/data", "uid": "1000" }`)
+			Expect(store.IsBindingConflict("binding-id", binding)).To(BeFalse())
+
+			binding.RawParameters = json.RawMessage(`{"mount":"/other"}`)
+			Expect(store.IsBindingConflict("binding-id", binding)).To(BeTrue())
+
+			binding.RawParameters = nil
+			Expect(store.IsBindingConflict("binding-id", binding)).To(BeTrue())
+		})
+
+		It("conflicts with a binding for a different app, plan or service", func() {
+			for _, change := range []func(*domain.BindDetails){
+				func(d *domain.BindDetails) { d.AppGUID = "other-app-guid" },
+				func(d *domain.BindDetails) { d.PlanID = "other-plan-id" },
+				func(d *domain.BindDetails) { d.ServiceID = "other-service-id" },
+			} {
+				changed := binding
+				change(&changed)
+				Expect(store.IsBindingConflict("binding-id", changed)).To(BeTrue())
+			}
+		})
+
+		Context("when a binding was stored with its parameters redacted", func() {
+			BeforeEach(func() {
+				hash, err := bcrypt.GenerateFromPassword(binding.RawParameters, bcrypt.MinCost)
+				Expect(err).NotTo(HaveOccurred())
+
+				redacted := binding
+				redacted.RawParameters, err = json.Marshal(map[string]interface{}{brokerstore.HashKey: string(hash)})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(store.CreateBindingDetails("redacted-binding-id", redacted)).To(Succeed())
+			})
+
+			It("keeps the hash", func() {
+				retrievedBinding, err := store.RetrieveBindingDetails("redacted-binding-id")
+				Expect(err).NotTo(HaveOccurred())
+
+				var params map[string]interface{}
+				Expect(json.Unmarshal(retrievedBinding.RawParameters, &params)).To(Succeed())
+				Expect(params).To(HaveKey(brokerstore.HashKey))
+			})
+
+			It("compares parameters against the hash", func() {
+				Expect(store.IsBindingConflict("redacted-binding-id", binding)).To(BeFalse())
+
+				binding.RawParameters = json.RawMessage(`{"mount":"/other"}`)
+				Expect(store.IsBindingConflict("redacted-binding-id", binding)).To(BeTrue())
+			})
+		})
+	})
+
+	Context("when saved and restored", func() {
+		var restored brokerstore.Store
+
+		BeforeEach(func() {
+			Expect(store.CreateInstanceDetails("instance-id", instance)).To(Succeed())
+			Expect(store.CreateBindingDetails("binding-id", binding)).To(Succeed())
+			Expect(store.Save(logger)).To(Succeed())
+
+			restored = reopen(store)
+			Expect(restored.Restore(logger)).To(Succeed())
+		})
+
+		It("keeps the details", func() {
+			storedInstance, err := store.RetrieveInstanceDetails("instance-id")
+			Expect(err).NotTo(HaveOccurred())
+			restoredInstance, err := restored.RetrieveInstanceDetails("instance-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restoredInstance).To(Equal(storedInstance))
+
+			restoredBinding, err := restored.RetrieveBindingDetails("binding-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restoredBinding.AppGUID).To(Equal("app-guid"))
+			Expect(restoredBinding.RawParameters).To(MatchJSON(binding.RawParameters))
+			Expect(restoredBinding.RawContext).To(MatchJSON(binding.RawContext))
+		})
+
+		It("detects conflicts as before", func() {
+			Expect(restored.IsInstanceConflict("instance-id", instance)).To(BeFalse())
+			Expect(restored.IsBindingConflict("binding-id", binding)).To(BeFalse())
+
+			binding.AppGUID = "other-app-guid"
+			Expect(restored.IsBindingConflict("binding-id", binding)).To(BeTrue())
+		})
+	})
+
+	It("can be used concurrently", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(id string) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				Expect(store.CreateInstanceDetails(id, instance)).To(Succeed())
+				Expect(store.CreateBindingDetails(id, binding)).To(Succeed())
+				Expect(store.Save(logger)).To(Succeed())
+				_, err := store.RetrieveAllInstanceDetails()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(store.IsBindingConflict(id, binding)).To(BeFalse())
+			}(fmt.Sprintf("id-%d", i))
+		}
+		wg.Wait()
+
+		restored := reopen(store)
+		Expect(restored.Restore(logger)).To(Succeed())
+		instances, err := restored.RetrieveAllInstanceDetails()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instances).To(HaveLen(10))
+	})
+}
@@ -0,0 +1,160 @@
+package existingvolumebroker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+var defaultDisallowedMountPaths = []string{"/bin", "/boot", "/dev", "/etc", "/lib", "/lib64", "/proc", "/sbin", "/sys", "/usr"}
+
+// validateMountPath returns the cleaned form of a mount path, or an error when
+// the path is relative, climbs up the directory tree, or is the root or within
+// one of the disallowed directories.
+func validateMountPath(mountPath string, disallowed []string) (string, error) {
+	if !strings.HasPrefix(mountPath, "/") {
+		return "", fmt.Errorf("mount path '%s' is not absolute", mountPath)
+	}
+	for _, component := range strings.Split(mountPath, "/") {
+		if component == ".." {
+			return "", fmt.Errorf("mount path '%s' must not contain '..'", mountPath)
+		}
+	}
+
+	cleaned := path.Clean(mountPath)
+	if cleaned == "/" {
+		return "", fmt.Errorf("mount path '%s' is not allowed", mountPath)
+	}
+	for _, directory := range disallowed {
+		if withinPath(cleaned, directory) {
+			return "", fmt.Errorf("mount path '%s' is within the system directory '%s'", mountPath, path.Clean(directory))
+		}
+	}
+
+	return cleaned, nil
+}
+
+func invalidMountPath(logger lager.Logger, err error) error {
+	logger.Error("err-invalid-mount-path", err)
+	return apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-mount-path")
+}
+
+// validateInstanceMountPath fails the configuration of a service instance
+// with a mount path that none of its bindings could be mounted at.
+func (b *Broker) validateInstanceMountPath(logger lager.Logger, configuration map[string]interface{}) error {
+	if mountPath, ok := configuration["mount"]; !ok || mountPath == nil {
+		return nil
+	}
+	if _, err := evaluateContainerPath(configuration, "", b.DisallowedMountPaths); err != nil {
+		return invalidMountPath(logger, err)
+	}
+	return nil
+}
+
+// checkMountPathConflicts fails a binding for an app whose mount path is the
+// same as, or nested with, the mount path of another binding for the app. The
+// caller holds the lock of the app, so that no other binding for the app is
+// recorded in the meantime.
+func (b *Broker) checkMountPathConflicts(logger lager.Logger, appGUID string, bindingID string, mountPath string) error {
+	mountPaths := b.appMountPaths(appGUID)
+
+	otherBindingIDs := []string{}
+	for otherBindingID := range mountPaths {
+		if otherBindingID != bindingID {
+			otherBindingIDs = append(otherBindingIDs, otherBindingID)
+		}
+	}
+	sort.Strings(otherBindingIDs)
+
+	for _, otherBindingID := range otherBindingIDs {
+		otherMountPath := mountPaths[otherBindingID]
+		if withinPath(mountPath, otherMountPath) || withinPath(otherMountPath, mountPath) {
+			err := fmt.Errorf("mount path '%s' conflicts with mount path '%s' of binding '%s' for the same app", mountPath, otherMountPath, otherBindingID)
+			logger.Error("err-mount-path-conflict", err)
+			return apiresponses.NewFailureResponse(err, http.StatusBadRequest, "mount-path-conflict")
+		}
+	}
+
+	return nil
+}
+
+// appMountPaths returns the mount paths recorded for the bindings of an app, by
+// binding ID. Bindings created before mount paths were recorded are not
+// included.
+func (b *Broker) appMountPaths(appGUID string) map[string]string {
+	record, err := b.records.retrieve(appBindingsRecord, appGUID)
+	if err != nil {
+		return map[string]string{}
+	}
+
+	bindings, _ := record[appBindingsKey].(map[string]interface{})
+
+	mountPaths := map[string]string{}
+	for bindingID, value := range bindings {
+		if mountPath, ok := value.(string); ok {
+			mountPaths[bindingID] = mountPath
+		}
+	}
+	return mountPaths
+}
+
+// recordMountPath records the mount path of a binding for an app. The caller
+// holds the lock of the app.
+func (b *Broker) recordMountPath(appGUID string, bindingID string, mountPath string) error {
+	mountPaths := b.appMountPaths(appGUID)
+	if mountPaths[bindingID] == mountPath {
+		return nil
+	}
+
+	mountPaths[bindingID] = mountPath
+	return b.writeAppMountPaths(appGUID, mountPaths)
+}
+
+// forgetMountPath removes the mount path of a binding from the records of its
+// app, if it is a binding for an app.
+func (b *Broker) forgetMountPath(logger lager.Logger, bindingID string, bindDetails domain.BindDetails) {
+	appGUID := bindingAppGUID(bindDetails)
+	if appGUID == "" {
+		return
+	}
+
+	// the binding is already gone, so the request context is not used to give
+	// up on the lock
+	_ = b.appLocks.Lock(context.Background(), appGUID)
+	defer b.appLocks.Unlock(appGUID)
+
+	b.removeMountPath(logger, appGUID, bindingID)
+}
+
+// removeMountPath removes the mount path of a binding from the records of an
+// app. The caller holds the lock of the app.
+func (b *Broker) removeMountPath(logger lager.Logger, appGUID string, bindingID string) {
+	mountPaths := b.appMountPaths(appGUID)
+	if _, ok := mountPaths[bindingID]; !ok {
+		return
+	}
+	delete(mountPaths, bindingID)
+
+	if len(mountPaths) == 0 {
+		b.records.forget(logger, appBindingsRecord, appGUID)
+		return
+	}
+	if err := b.writeAppMountPaths(appGUID, mountPaths); err != nil {
+		logger.Error("failed-to-record-app-mount-paths", err, lager.Data{"appGUID": appGUID})
+	}
+}
+
+func (b *Broker) writeAppMountPaths(appGUID string, mountPaths map[string]string) error {
+	bindings := make(map[string]interface{}, len(mountPaths))
+	for bindingID, mountPath := range mountPaths {
+		bindings[bindingID] = mountPath
+	}
+	return b.records.create(appBindingsRecord, appGUID, map[string]interface{}{appBindingsKey: bindings})
+}
@@ -0,0 +1,186 @@
+package existingvolumebroker_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+// unlistableStore cannot list instances or bindings, like the CredHub store.
+type unlistableStore struct {
+	brokerstore.Store
+}
+
+func (unlistableStore) RetrieveAllInstanceDetails() (map[string]brokerstore.ServiceInstance, error) {
+	panic("Not Implemented")
+}
+
+func (unlistableStore) RetrieveAllBindingDetails() (map[string]domain.BindDetails, error) {
+	panic("Not Implemented")
+}
+
+var _ = Describe("Mount paths", func() {
+	var (
+		ctx    = context.TODO()
+		broker testBroker
+	)
+
+	BeforeEach(func() {
+		broker = provisionTestBroker(
+			existingvolumebroker.BrokerTypeNFS,
+			lagertest.NewTestLogger("test-broker"),
+			testConfigMask("source", "mount"),
+			unlistableStore{localstore.NewMemoryStore()},
+			`{"share":"server/some-share"}`,
+			"some-instance-id", "other-instance-id",
+		)
+	})
+
+	It("mounts at the cleaned mount path", func() {
+		binding, err := broker.bindApp("some-instance-id", "binding-id", "guid", `{"mount":"/var/vcap/data//some-dir/"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(binding.VolumeMounts[0].ContainerDir).To(Equal("/var/vcap/data/some-dir"))
+	})
+
+	DescribeTable("rejects invalid mount paths",
+		func(params string, message string) {
+			_, err := broker.bindApp("some-instance-id", "binding-id", "guid", params)
+			Expect(err).To(MatchError(message))
+			Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+		},
+		Entry("a relative path", `{"mount":"data"}`, "mount path 'data' is not absolute"),
+		Entry("a path climbing up", `{"mount":"/data/../etc"}`, "mount path '/data/../etc' must not contain '..'"),
+		Entry("the root", `{"mount":"//"}`, "mount path '//' is not allowed"),
+		Entry("a system directory", `{"mount":"/etc"}`, "mount path '/etc' is within the system directory '/etc'"),
+		Entry("a path within a system directory", `{"mount":"/usr/local/data"}`, "mount path '/usr/local/data' is within the system directory '/usr'"),
+		Entry("a path that is not a string", `{"mount":42}`, "mount path must be a string"),
+	)
+
+	It("rejects invalid mount paths of instances", func() {
+		_, err := broker.Provision(ctx, "new-instance-id", domain.ProvisionDetails{
+			RawParameters: json.RawMessage(`{"share":"server/some-share","mount":"/etc/data"}`),
+		}, false)
+		Expect(err).To(MatchError("mount path '/etc/data' is within the system directory '/etc'"))
+		Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+
+		_, err = broker.Update(ctx, "some-instance-id", domain.UpdateDetails{
+			RawParameters: json.RawMessage(`{"mount":"/etc/x"}`),
+		}, false)
+		Expect(err).To(MatchError("mount path '/etc/x' is within the system directory '/etc'"))
+		Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+
+		_, err = broker.bindApp("some-instance-id", "binding-id", "guid", `{}`)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("accepts valid mount paths of instances, and their removal", func() {
+		_, err := broker.Update(ctx, "some-instance-id", domain.UpdateDetails{
+			RawParameters: json.RawMessage(`{"mount":"/var/vcap/data/some-dir"}`),
+		}, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = broker.Update(ctx, "some-instance-id", domain.UpdateDetails{
+			RawParameters: json.RawMessage(`{"mount":null}`),
+		}, false)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects paths within the configured disallowed directories", func() {
+		broker.DisallowedMountPaths = []string{"/home/vcap/app/"}
+
+		_, err := broker.bindApp("some-instance-id", "binding-id", "guid", `{"mount":"/home/vcap/app/data"}`)
+		Expect(err).To(MatchError("mount path '/home/vcap/app/data' is within the system directory '/home/vcap/app'"))
+
+		_, err = broker.bindApp("some-instance-id", "binding-id", "guid", `{"mount":"/etc/data"}`)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("given a binding for an app", func() {
+		BeforeEach(func() {
+			_, err := broker.bindApp("some-instance-id", "binding-id", "guid", `{"mount":"/var/vcap/data/shared"}`)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		DescribeTable("rejects another binding for the app with a conflicting mount path",
+			func(mountPath string) {
+				_, err := broker.bindApp("other-instance-id", "other-binding-id", "guid", `{"mount":"`+mountPath+`"}`)
+				Expect(err).To(MatchError("mount path '" + mountPath + "' conflicts with mount path '/var/vcap/data/shared' of binding 'binding-id' for the same app"))
+				Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+			},
+			Entry("the same path", "/var/vcap/data/shared"),
+			Entry("a path within it", "/var/vcap/data/shared/other"),
+			Entry("a path containing it", "/var/vcap/data"),
+		)
+
+		It("allows other mount paths for the app", func() {
+			_, err := broker.bindApp("other-instance-id", "other-binding-id", "guid", `{"mount":"/var/vcap/data/shared-other"}`)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("allows the same mount path for other apps", func() {
+			_, err := broker.bindApp("other-instance-id", "other-binding-id", "other-guid", `{"mount":"/var/vcap/data/shared"}`)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("allows the binding to be repeated", func() {
+			_, err := broker.bindApp("some-instance-id", "binding-id", "guid", `{"mount":"/var/vcap/data/shared"}`)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("allows the mount path again once the binding is deleted", func() {
+			_, err := broker.Unbind(ctx, "some-instance-id", "binding-id", domain.UnbindDetails{}, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = broker.bindApp("other-instance-id", "other-binding-id", "guid", `{"mount":"/var/vcap/data/shared"}`)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("allows the mount path again once the instance of the binding is deprovisioned", func() {
+			broker.DeprovisionPolicy = existingvolumebroker.DeprovisionPolicyCascade
+
+			_, err := broker.Deprovision(ctx, "some-instance-id", domain.DeprovisionDetails{}, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = broker.bindApp("other-instance-id", "other-binding-id", "guid", `{"mount":"/var/vcap/data/shared"}`)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	It("admits only one of concurrent bindings for an app with the same mount path", func() {
+		instanceIDs := []string{"some-instance-id", "other-instance-id"}
+		errs := make(chan error, len(instanceIDs))
+
+		var wg sync.WaitGroup
+		for _, instanceID := range instanceIDs {
+			wg.Add(1)
+			go func(instanceID string) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				_, err := broker.bindApp(instanceID, "binding-id-"+instanceID, "guid", `{"mount":"/var/vcap/data/shared"}`)
+				errs <- err
+			}(instanceID)
+		}
+		wg.Wait()
+		close(errs)
+
+		succeeded := 0
+		for err := range errs {
+			if err == nil {
+				succeeded++
+				continue
+			}
+			Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+		}
+		Expect(succeeded).To(Equal(1))
+	})
+})
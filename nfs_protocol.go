@@ -0,0 +1,61 @@
+package existingvolumebroker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var nfsShareWithColon = regexp.MustCompile("^[^/]+:/")
+
+// NFSProtocol binds NFSv3 shares, given as "server[:port]/path", to the
+// nfsv3driver.
+type NFSProtocol struct{}
+
+func (NFSProtocol) ParseShare(share string) (Share, error) {
+	if nfsShareWithColon.MatchString(share) {
+		return Share{}, shareSyntaxError("no colon allowed after server")
+	}
+
+	server, sharePath, ok := strings.Cut(share, "/")
+	if !ok {
+		return Share{}, shareSyntaxError("missing path after server")
+	}
+
+	parsedServer, err := parseServer(server, true)
+	if err != nil {
+		return Share{}, err
+	}
+
+	cleanedPath, err := cleanPath("/" + sharePath)
+	if err != nil {
+		return Share{}, err
+	}
+
+	return Share{
+		Servers:   []Server{parsedServer},
+		Path:      cleanedPath,
+		Canonical: parsedServer.String() + cleanedPath,
+	}, nil
+}
+
+// Source prefixes the share with nfs:// for backwards compatibility, as the
+// mapfs-mounter would otherwise not construct the correct mount string for the
+// kernel mount.
+//
+// see (https://github.com/cloudfoundry/nfsv3driver/blob/ac1e1d26fec9a8551cacfabafa6e035f233c83e0/mapfs_mounter.go#L121)
+func (NFSProtocol) Source(share string) string {
+	return fmt.Sprintf("nfs://%s", share)
+}
+
+func (NFSProtocol) DriverName() string {
+	return "nfsv3driver"
+}
+
+func (NFSProtocol) MountConfig(mountOpts map[string]interface{}) (map[string]interface{}, error) {
+	return mountOpts, nil
+}
+
+func (NFSProtocol) KubernetesVolumeSource(volume KubernetesVolume) (map[string]interface{}, []string) {
+	return nfsKubernetesVolumeSource(volume)
+}
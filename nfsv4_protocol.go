@@ -0,0 +1,148 @@
+package existingvolumebroker
+
+import (
+	"fmt"
+	"strings"
+
+	vmo "code.cloudfoundry.org/volume-mount-options"
+)
+
+// nfsv3OnlyOptions are mount options of the NFSv3 side protocols, which NFSv4
+// does without.
+var nfsv3OnlyOptions = []string{
+	"mountport", "mountproto", "mounthost", "mountvers",
+	"lock", "nolock", "local_lock", "acl", "noacl", "udp",
+}
+
+var nfsv4OptionValues = map[string][]string{
+	VERSION_KEY:    {"4", "4.0", "4.1", "4.2"},
+	"minorversion": {"0", "1", "2"},
+	"sec":          {"sys", "krb5", "krb5i", "krb5p"},
+}
+
+// NFSv4Protocol binds NFSv4 shares, given as "server:/path", to the
+// nfsv4driver. The "server/path" form of the NFSv3 flavour is accepted too.
+type NFSv4Protocol struct{}
+
+func (NFSv4Protocol) ParseShare(share string) (Share, error) {
+	if err := rejectURL(share); err != nil {
+		return Share{}, err
+	}
+
+	var server, sharePath string
+	if strings.HasPrefix(share, "[") {
+		end := strings.Index(share, "]")
+		if end < 0 {
+			return Share{}, shareSyntaxError("unterminated IPv6 address '%s'", share)
+		}
+		server, sharePath = share[:end+1], share[end+1:]
+	} else {
+		end := strings.Index(share, "/")
+		if end < 0 {
+			return Share{}, shareSyntaxError("missing path after server, expected server:/path")
+		}
+		server, sharePath = share[:end], share[end:]
+	}
+	sharePath = strings.TrimPrefix(sharePath, ":")
+	if !strings.HasPrefix(sharePath, "/") {
+		return Share{}, shareSyntaxError("missing path after server, expected server:/path")
+	}
+	server = strings.TrimSuffix(server, ":")
+
+	// the port of an NFSv4 server is given with the port mount option
+	parsedServer, err := parseServer(server, false)
+	if err != nil {
+		return Share{}, err
+	}
+
+	cleanedPath, err := cleanPath(sharePath)
+	if err != nil {
+		return Share{}, err
+	}
+
+	return Share{
+		Servers:   []Server{parsedServer},
+		Path:      cleanedPath,
+		Canonical: parsedServer.String() + ":" + cleanedPath,
+	}, nil
+}
+
+// Source returns the share in the server:/path form of NFSv4 mounts.
+func (p NFSv4Protocol) Source(share string) string {
+	parsed, err := p.ParseShare(share)
+	if err != nil {
+		return share
+	}
+	return parsed.Canonical
+}
+
+func (NFSv4Protocol) DriverName() string {
+	return "nfsv4driver"
+}
+
+// MountConfig pins the mount to NFSv4, and rejects a minor version that
+// contradicts the version.
+func (NFSv4Protocol) MountConfig(mountOpts map[string]interface{}) (map[string]interface{}, error) {
+	mountConfig := map[string]interface{}{}
+	for k, v := range mountOpts {
+		mountConfig[k] = v
+	}
+
+	version, ok := mountConfig[VERSION_KEY].(string)
+	if !ok {
+		mountConfig[VERSION_KEY] = "4"
+		return mountConfig, nil
+	}
+
+	if minorVersion, ok := mountConfig["minorversion"].(string); ok && strings.HasPrefix(version, "4.") {
+		if version != "4."+minorVersion {
+			return nil, fmt.Errorf("minorversion %s conflicts with version %s", minorVersion, version)
+		}
+	}
+
+	return mountConfig, nil
+}
+
+// Mask allows the NFSv4 options minorversion and sec, restricts their values
+// and those of version to ones NFSv4 understands, and drops the NFSv3-only
+// options from the allowed options so that they are rejected.
+func (NFSv4Protocol) Mask(mask vmo.MountOptsMask) vmo.MountOptsMask {
+	allowed := []string{}
+	for _, option := range mask.Allowed {
+		if !containsString(nfsv3OnlyOptions, option) {
+			allowed = append(allowed, option)
+		}
+	}
+	for _, option := range []string{"minorversion", "sec"} {
+		if !containsString(allowed, option) {
+			allowed = append(allowed, option)
+		}
+	}
+	mask.Allowed = allowed
+
+	validations := append([]vmo.UserOptsValidation{}, mask.ValidationFunc...)
+	mask.ValidationFunc = append(validations, vmo.UserOptsValidationFunc(validateNFSv4Option))
+
+	return mask
+}
+
+func (NFSv4Protocol) KubernetesVolumeSource(volume KubernetesVolume) (map[string]interface{}, []string) {
+	return nfsKubernetesVolumeSource(volume)
+}
+
+func validateNFSv4Option(key string, value string) error {
+	values, ok := nfsv4OptionValues[key]
+	if !ok || containsString(values, value) {
+		return nil
+	}
+	return fmt.Errorf("%s must be one of ['%s'], got '%s'", key, strings.Join(values, "', '"), value)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package existingvolumebroker_test
+
+import (
+	"context"
+	"encoding/json"
+
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/fakes"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	vmo "code.cloudfoundry.org/volume-mount-options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+var _ = Describe("NFSv4Protocol", func() {
+	protocol := existingvolumebroker.NFSv4Protocol{}
+
+	It("rejects URLs", func() {
+		_, err := protocol.ParseShare("nfs://server/export")
+		Expect(err).To(MatchError("syntax error for share: URLs are not supported"))
+	})
+
+	It("mounts with the nfsv4driver from a server:/path source", func() {
+		Expect(protocol.DriverName()).To(Equal("nfsv4driver"))
+		Expect(protocol.Source("server/export")).To(Equal("server:/export"))
+		Expect(protocol.Source("server:/export")).To(Equal("server:/export"))
+		Expect(protocol.Source("[fd00:0::1]/export/")).To(Equal("[fd00::1]:/export"))
+		Expect(protocol.Source("not a share")).To(Equal("not a share"))
+	})
+
+	Context("MountConfig", func() {
+		It("defaults the version to 4", func() {
+			mountConfig, err := protocol.MountConfig(map[string]interface{}{"source": "server:/export"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mountConfig).To(Equal(map[string]interface{}{"source": "server:/export", "version": "4"}))
+		})
+
+		It("rejects a minor version that contradicts the version", func() {
+			_, err := protocol.MountConfig(map[string]interface{}{"version": "4.1", "minorversion": "1"})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = protocol.MountConfig(map[string]interface{}{"version": "4.1", "minorversion": "2"})
+			Expect(err).To(MatchError("minorversion 2 conflicts with version 4.1"))
+		})
+	})
+
+	Context("Mask", func() {
+		var mask vmo.MountOptsMask
+
+		BeforeEach(func() {
+			var err error
+			mask, err = vmo.NewMountOptsMask(
+				[]string{"source", "uid", "nolock", "mountvers", "version"},
+				map[string]interface{}{},
+				map[string]string{},
+				[]string{},
+				[]string{"source"},
+			)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("allows the NFSv4 options and drops the NFSv3-only ones", func() {
+			Expect(protocol.Mask(mask).Allowed).To(ConsistOf("source", "uid", "version", "minorversion", "sec"))
+		})
+
+		It("does not modify the given mask", func() {
+			protocol.Mask(mask)
+			Expect(mask.Allowed).To(ConsistOf("source", "uid", "nolock", "mountvers", "version"))
+			Expect(mask.ValidationFunc).To(BeEmpty())
+		})
+	})
+
+	Context("when the broker type is NFSv4", func() {
+		var (
+			ctx    context.Context
+			broker *existingvolumebroker.Broker
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+
+			configMask, err := vmo.NewMountOptsMask(
+				[]string{"source", "mount", "uid", "gid", "version", "nolock"},
+				map[string]interface{}{},
+				map[string]string{"share": "source"},
+				[]string{},
+				[]string{"source"},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			broker = existingvolumebroker.New(
+				existingvolumebroker.BrokerTypeNFSv4,
+				lagertest.NewTestLogger("test-broker"),
+				&fakes.FakeServices{},
+				&os_fake.FakeOs{},
+				nil,
+				localstore.NewMemoryStore(),
+				configMask,
+			)
+
+			_, err = broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+				RawParameters: json.RawMessage(`{"share":"server:/export"}`),
+			}, false)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		bind := func(params string) (domain.Binding, error) {
+			return broker.Bind(ctx, "some-instance-id", "binding-id", domain.BindDetails{
+				AppGUID:       "guid",
+				RawParameters: json.RawMessage(params),
+			}, false)
+		}
+
+		It("binds with the mount config of an NFSv4 driver", func() {
+			binding, err := bind(`{"minorversion":"1","sec":"krb5p"}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(binding.VolumeMounts[0].Driver).To(Equal("nfsv4driver"))
+			Expect(binding.VolumeMounts[0].Device.MountConfig).To(Equal(map[string]interface{}{
+				"source":       "server:/export",
+				"version":      "4",
+				"minorversion": "1",
+				"sec":          "krb5p",
+			}))
+		})
+
+		It("rejects values NFSv4 does not understand", func() {
+			_, err := bind(`{"sec":"none"}`)
+			Expect(err).To(BeAssignableToTypeOf(&apiresponses.FailureResponse{}))
+			Expect(err.Error()).To(ContainSubstring("sec must be one of ['sys', 'krb5', 'krb5i', 'krb5p'], got 'none'"))
+
+			_, err = bind(`{"version":"3"}`)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects NFSv3-only options even when the mask allows them", func() {
+			_, err := bind(`{"nolock":"true"}`)
+			Expect(err).To(BeAssignableToTypeOf(&apiresponses.FailureResponse{}))
+			Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+			Expect(err.Error()).To(ContainSubstring("Not allowed options: nolock"))
+		})
+
+		It("rejects invalid shares on provision", func() {
+			_, err := broker.Provision(ctx, "other-instance-id", domain.ProvisionDetails{
+				RawParameters: json.RawMessage(`{"share":"server"}`),
+			}, false)
+			Expect(err).To(MatchError("syntax error for share: missing path after server, expected server:/path"))
+		})
+	})
+})
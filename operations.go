@@ -0,0 +1,84 @@
+package existingvolumebroker
+
+import (
+	"errors"
+	"fmt"
+
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+)
+
+const (
+	provisionOperation = "provision"
+	bindOperation      = "bind"
+
+	operationKey            = "operation"
+	operationStateKey       = "state"
+	operationDescriptionKey = "description"
+)
+
+var errOperationNotFound = errors.New("operation not found")
+
+// operationTracker records the state of asynchronous operations in the broker
+// store, apart from the instances and bindings they act upon, so that the state
+// can be polled by the platform and survives a broker restart. The operations
+// on instances and those on bindings are recorded as records of different
+// kinds, so their IDs cannot collide.
+type operationTracker struct {
+	records records
+}
+
+func newOperationTracker(records records) *operationTracker {
+	return &operationTracker{records: records}
+}
+
+func (t *operationTracker) start(kind string, id string, operation string) error {
+	return t.record(kind, id, operation, domain.InProgress, "")
+}
+
+func (t *operationTracker) finish(kind string, id string, operation string, err error) error {
+	if err != nil {
+		return t.record(kind, id, operation, domain.Failed, err.Error())
+	}
+	return t.record(kind, id, operation, domain.Succeeded, "")
+}
+
+func (t *operationTracker) lastOperation(kind string, id string, operation string) (domain.LastOperation, error) {
+	fields, err := t.records.retrieve(kind, id)
+	if err == errMalformedRecord {
+		return domain.LastOperation{}, errors.New("unable to deserialize operation")
+	}
+	if err != nil {
+		return domain.LastOperation{}, errOperationNotFound
+	}
+
+	if fields[operationKey] != operation {
+		return domain.LastOperation{}, fmt.Errorf("no %s operation recorded", operation)
+	}
+
+	state, ok := fields[operationStateKey].(string)
+	if !ok {
+		return domain.LastOperation{}, errors.New("unable to deserialize operation")
+	}
+	description, _ := fields[operationDescriptionKey].(string)
+
+	return domain.LastOperation{State: domain.LastOperationState(state), Description: description}, nil
+}
+
+// inProgress reports whether the given operation is still running.
+func (t *operationTracker) inProgress(kind string, id string, operation string) bool {
+	lastOperation, err := t.lastOperation(kind, id, operation)
+	return err == nil && lastOperation.State == domain.InProgress
+}
+
+func (t *operationTracker) forget(logger lager.Logger, kind string, id string) {
+	t.records.forget(logger, kind, id)
+}
+
+func (t *operationTracker) record(kind string, id string, operation string, state domain.LastOperationState, description string) error {
+	return t.records.create(kind, id, map[string]interface{}{
+		operationKey:            operation,
+		operationStateKey:       string(state),
+		operationDescriptionKey: description,
+	})
+}
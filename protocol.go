@@ -0,0 +1,50 @@
+package existingvolumebroker
+
+import vmo "code.cloudfoundry.org/volume-mount-options"
+
+// Protocol captures what differs between the kinds of share the broker can
+// bind, so that a new kind of share can be supported without changes to the
+// broker itself.
+type Protocol interface {
+	// ParseShare breaks a share down into its components, and rejects shares
+	// that cannot be mounted with this protocol.
+	ParseShare(share string) (Share, error)
+	// Source returns the mount source the volume driver expects for a share as
+	// stored by the broker. Shares of instances provisioned before shares were
+	// normalized may not be canonical.
+	Source(share string) string
+	// DriverName returns the name of the volume driver that mounts the share.
+	DriverName() string
+	// MountConfig post-processes the mount options of a binding into the mount
+	// configuration handed to the volume driver.
+	MountConfig(mountOpts map[string]interface{}) (map[string]interface{}, error)
+}
+
+// MountOptionsMasker is implemented by protocols that adjust the mount options
+// mask the broker is constructed with, for example to allow options of their
+// own or to reject options they do not support.
+type MountOptionsMasker interface {
+	Mask(mask vmo.MountOptsMask) vmo.MountOptsMask
+}
+
+// KubernetesVolumeSourcer is implemented by protocols whose shares Kubernetes
+// can mount. Bindings on Kubernetes are refused for shares of other protocols.
+type KubernetesVolumeSourcer interface {
+	// KubernetesVolumeSource returns the volume source fields of the spec of a
+	// persistent volume for the volume, and its mount options.
+	KubernetesVolumeSource(volume KubernetesVolume) (map[string]interface{}, []string)
+}
+
+// protocolFor returns the built-in protocol for a broker type.
+func protocolFor(brokerType BrokerType) Protocol {
+	switch brokerType {
+	case BrokerTypeNFS:
+		return NFSProtocol{}
+	case BrokerTypeNFSv4:
+		return NFSv4Protocol{}
+	case BrokerTypeCephFS:
+		return CephFSProtocol{}
+	default:
+		return SMBProtocol{}
+	}
+}
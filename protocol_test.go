@@ -0,0 +1,145 @@
+package existingvolumebroker_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/fakes"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	vmo "code.cloudfoundry.org/volume-mount-options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+type glusterProtocol struct{}
+
+func (glusterProtocol) ParseShare(share string) (existingvolumebroker.Share, error) {
+	server, volume, ok := strings.Cut(share, ":")
+	if !ok {
+		return existingvolumebroker.Share{}, errors.New("share must be given as server:volume")
+	}
+	return existingvolumebroker.Share{
+		Servers:   []existingvolumebroker.Server{{Host: server}},
+		Path:      "/" + volume,
+		Canonical: share,
+	}, nil
+}
+
+func (glusterProtocol) Source(share string) string {
+	return "gluster://" + share
+}
+
+func (glusterProtocol) DriverName() string {
+	return "glusterdriver"
+}
+
+func (glusterProtocol) MountConfig(mountOpts map[string]interface{}) (map[string]interface{}, error) {
+	if _, ok := mountOpts["transport"]; ok {
+		return nil, errors.New("transport cannot be configured")
+	}
+	mountConfig := map[string]interface{}{"transport": "tcp"}
+	for k, v := range mountOpts {
+		mountConfig[k] = v
+	}
+	return mountConfig, nil
+}
+
+var _ = Describe("Protocols", func() {
+	Context("NFSProtocol", func() {
+		protocol := existingvolumebroker.NFSProtocol{}
+
+		It("rejects a colon after the server", func() {
+			_, err := protocol.ParseShare("server:/some-share")
+			Expect(err).To(MatchError("syntax error for share: no colon allowed after server"))
+		})
+
+		It("mounts with the nfsv3driver from an nfs:// source", func() {
+			Expect(protocol.DriverName()).To(Equal("nfsv3driver"))
+			Expect(protocol.Source("server/some-share")).To(Equal("nfs://server/some-share"))
+		})
+	})
+
+	Context("SMBProtocol", func() {
+		protocol := existingvolumebroker.SMBProtocol{}
+
+		It("mounts with the smbdriver from the share", func() {
+			Expect(protocol.DriverName()).To(Equal("smbdriver"))
+			Expect(protocol.Source("//server/some-share")).To(Equal("//server/some-share"))
+		})
+	})
+
+	Context("when the broker is given a protocol of its own", func() {
+		var (
+			ctx    context.Context
+			broker *existingvolumebroker.Broker
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+
+			configMask, err := vmo.NewMountOptsMask(
+				[]string{"source", "mount", "transport"},
+				map[string]interface{}{},
+				map[string]string{"share": "source"},
+				[]string{},
+				[]string{"source"},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			broker = existingvolumebroker.NewWithProtocol(
+				glusterProtocol{},
+				lagertest.NewTestLogger("test-broker"),
+				&fakes.FakeServices{},
+				&os_fake.FakeOs{},
+				nil,
+				localstore.NewMemoryStore(),
+				configMask,
+			)
+		})
+
+		It("validates shares with the protocol", func() {
+			_, err := broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+				RawParameters: json.RawMessage(`{"share":"server"}`),
+			}, false)
+			Expect(err).To(MatchError("share must be given as server:volume"))
+		})
+
+		Context("given an instance", func() {
+			BeforeEach(func() {
+				_, err := broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+					RawParameters: json.RawMessage(`{"share":"server:volume"}`),
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("binds with the driver, source and mount config of the protocol", func() {
+				binding, err := broker.Bind(ctx, "some-instance-id", "binding-id", domain.BindDetails{AppGUID: "guid"}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(binding.VolumeMounts).To(HaveLen(1))
+				Expect(binding.VolumeMounts[0].Driver).To(Equal("glusterdriver"))
+				Expect(binding.VolumeMounts[0].Device.MountConfig).To(Equal(map[string]interface{}{
+					"source":    "gluster://server:volume",
+					"transport": "tcp",
+				}))
+			})
+
+			It("fails the bind when the protocol rejects the mount options", func() {
+				_, err := broker.Bind(ctx, "some-instance-id", "binding-id", domain.BindDetails{
+					AppGUID:       "guid",
+					RawParameters: json.RawMessage(`{"transport":"rdma"}`),
+				}, false)
+				Expect(err).To(MatchError("transport cannot be configured"))
+				Expect(err).To(BeAssignableToTypeOf(&apiresponses.FailureResponse{}))
+				Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+			})
+		})
+	})
+})
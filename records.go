@@ -0,0 +1,119 @@
+package existingvolumebroker
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+// RecordStore is implemented by stores that can keep the records of the broker
+// itself, such as the state of asynchronous operations, apart from service
+// instances and bindings. Other stores keep the records as service instances,
+// under IDs in a namespace of their own that the broker refuses as instance
+// and binding IDs.
+type RecordStore interface {
+	RetrieveRecord(id string) (map[string]interface{}, error)
+	CreateRecord(id string, record map[string]interface{}) error
+	DeleteRecord(id string) error
+}
+
+const recordNamespace = "existingvolumebroker-records"
+
+// record kinds, each of which is a key space of its own
+const (
+	instanceOperationRecord = "instance-operation"
+	bindingOperationRecord  = "binding-operation"
+	bindingRecord           = "binding"
+	instanceBindingsRecord  = "instance-bindings"
+	appBindingsRecord       = "app-bindings"
+)
+
+var (
+	errReservedID      = errors.New("ID is reserved for the records of the broker")
+	errMalformedRecord = errors.New("unable to deserialize record")
+)
+
+type records struct {
+	store brokerstore.Store
+}
+
+func recordID(kind string, id string) string {
+	return recordNamespace + "/" + kind + "/" + id
+}
+
+func isReservedID(id string) bool {
+	return strings.HasPrefix(id, recordNamespace+"/")
+}
+
+func (r records) retrieve(kind string, id string) (map[string]interface{}, error) {
+	if recordStore, ok := r.store.(RecordStore); ok {
+		return recordStore.RetrieveRecord(recordID(kind, id))
+	}
+
+	details, err := r.store.RetrieveInstanceDetails(recordID(kind, id))
+	if err != nil {
+		return nil, err
+	}
+	record, ok := details.ServiceFingerPrint.(map[string]interface{})
+	if !ok {
+		return nil, errMalformedRecord
+	}
+	return record, nil
+}
+
+func (r records) create(kind string, id string, record map[string]interface{}) error {
+	if recordStore, ok := r.store.(RecordStore); ok {
+		return recordStore.CreateRecord(recordID(kind, id), record)
+	}
+	return r.store.CreateInstanceDetails(recordID(kind, id), brokerstore.ServiceInstance{ServiceFingerPrint: record})
+}
+
+func (r records) delete(kind string, id string) error {
+	if recordStore, ok := r.store.(RecordStore); ok {
+		return recordStore.DeleteRecord(recordID(kind, id))
+	}
+	return r.store.DeleteInstanceDetails(recordID(kind, id))
+}
+
+// forget deletes a record, if there is one.
+func (r records) forget(logger lager.Logger, kind string, id string) {
+	if _, err := r.retrieve(kind, id); err != nil {
+		return
+	}
+
+	if err := r.delete(kind, id); err != nil {
+		logger.Error("failed-to-delete-record", err, lager.Data{"kind": kind, "id": id})
+	}
+}
+
+// retrieveInstance retrieves a service instance, which is never one of the
+// records kept in its place.
+func (b *Broker) retrieveInstance(instanceID string) (brokerstore.ServiceInstance, error) {
+	if isReservedID(instanceID) {
+		return brokerstore.ServiceInstance{}, errReservedID
+	}
+	return b.store.RetrieveInstanceDetails(instanceID)
+}
+
+func (b *Broker) retrieveBinding(bindingID string) (domain.BindDetails, error) {
+	if isReservedID(bindingID) {
+		return domain.BindDetails{}, errReservedID
+	}
+	return b.store.RetrieveBindingDetails(bindingID)
+}
+
+// refuseReservedIDs fails the creation of instances and bindings whose IDs
+// could be mistaken for records.
+func refuseReservedIDs(ids ...string) error {
+	for _, id := range ids {
+		if isReservedID(id) {
+			return apiresponses.NewFailureResponse(errReservedID, http.StatusBadRequest, "reserved-id")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package existingvolumebroker
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const redactedValue = "*REDACTED*"
+
+// redactingLogger masks the values of sensitive keys, at any depth, in the data
+// of every message logged through it and of every session derived from it.
+// Sensitive keys are looked up on each message so that they can be configured
+// after the broker is constructed.
+type redactingLogger struct {
+	lager.Logger
+	sensitiveKeys func() []string
+}
+
+func newRedactingLogger(logger lager.Logger, sensitiveKeys func() []string) lager.Logger {
+	return &redactingLogger{Logger: logger, sensitiveKeys: sensitiveKeys}
+}
+
+func (l *redactingLogger) Session(task string, data ...lager.Data) lager.Logger {
+	return &redactingLogger{Logger: l.Logger.Session(task, l.redact(data)...), sensitiveKeys: l.sensitiveKeys}
+}
+
+func (l *redactingLogger) WithData(data lager.Data) lager.Logger {
+	return &redactingLogger{Logger: l.Logger.WithData(l.redactData(data)), sensitiveKeys: l.sensitiveKeys}
+}
+
+func (l *redactingLogger) WithTraceInfo(req *http.Request) lager.Logger {
+	return &redactingLogger{Logger: l.Logger.WithTraceInfo(req), sensitiveKeys: l.sensitiveKeys}
+}
+
+func (l *redactingLogger) Debug(action string, data ...lager.Data) {
+	l.Logger.Debug(action, l.redact(data)...)
+}
+
+func (l *redactingLogger) Info(action string, data ...lager.Data) {
+	l.Logger.Info(action, l.redact(data)...)
+}
+
+func (l *redactingLogger) Error(action string, err error, data ...lager.Data) {
+	l.Logger.Error(action, err, l.redact(data)...)
+}
+
+func (l *redactingLogger) Fatal(action string, err error, data ...lager.Data) {
+	l.Logger.Fatal(action, err, l.redact(data)...)
+}
+
+func (l *redactingLogger) redact(data []lager.Data) []lager.Data {
+	redacted := make([]lager.Data, len(data))
+	for i, d := range data {
+		redacted[i] = l.redactData(d)
+	}
+	return redacted
+}
+
+func (l *redactingLogger) redactData(data lager.Data) lager.Data {
+	if data == nil {
+		return nil
+	}
+
+	keys := l.sensitiveKeys()
+	redacted := lager.Data{}
+	for k, v := range data {
+		if isSensitiveKey(keys, k) {
+			redacted[k] = redactedValue
+			continue
+		}
+		redacted[k] = redactValue(keys, v)
+	}
+	return redacted
+}
+
+// redactValue converts the value to its JSON representation, which is what the
+// log sinks will write, so that sensitive keys are found in structs and raw
+// JSON messages as well as in maps.
+func redactValue(keys []string, value interface{}) interface{} {
+	switch value.(type) {
+	case nil, bool, int, int64, float64, string:
+		return value
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return value
+	}
+
+	return redactDecoded(keys, decoded)
+}
+
+func redactDecoded(keys []string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, nested := range v {
+			if isSensitiveKey(keys, k) {
+				v[k] = redactedValue
+				continue
+			}
+			v[k] = redactDecoded(keys, nested)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = redactDecoded(keys, nested)
+		}
+	}
+	return value
+}
+
+func isSensitiveKey(keys []string, key string) bool {
+	for _, sensitive := range keys {
+		if strings.EqualFold(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package existingvolumebroker_test
+
+import (
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Log redaction", func() {
+	var (
+		logger *lagertest.TestLogger
+		broker testBroker
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test-broker")
+		broker = testBroker{newTestBroker(
+			existingvolumebroker.BrokerTypeSMB,
+			logger,
+			testConfigMask("domain", "mount", "password", "source", "uid", "username"),
+			localstore.NewMemoryStore(),
+		)}
+	})
+
+	JustBeforeEach(func() {
+		broker.provision("some-instance-id", `{"share":"//server/some-share","username":"secret-user","password":"secret-password","domain":"secret-domain","uid":"1234"}`)
+
+		_, err := broker.bindApp("some-instance-id", "binding-id", "guid", `{"password":"secret-bind-password"}`)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("masks credentials in the details, instance and mount options it logs", func() {
+		Expect(logger.Buffer()).To(gbytes.Say("provision.start"))
+		Expect(logger.Buffer()).To(gbytes.Say("volume-service-binding"))
+		Expect(logger.Buffer().Contents()).To(ContainSubstring(`"password":"*REDACTED*"`))
+		Expect(logger.Buffer().Contents()).To(ContainSubstring(`"username":"*REDACTED*"`))
+		Expect(logger.Buffer().Contents()).To(ContainSubstring(`"domain":"*REDACTED*"`))
+		Expect(logger.Buffer().Contents()).To(ContainSubstring("1234"))
+
+		Expect(logger.Buffer().Contents()).NotTo(ContainSubstring("secret-"))
+	})
+
+	Context("when additional keys are configured as sensitive", func() {
+		BeforeEach(func() {
+			broker.SensitiveKeys = append(broker.SensitiveKeys, "uid")
+		})
+
+		It("masks them too", func() {
+			Expect(logger.Buffer().Contents()).NotTo(ContainSubstring("secret-"))
+			Expect(logger.Buffer().Contents()).NotTo(ContainSubstring("1234"))
+		})
+	})
+})
@@ -0,0 +1,98 @@
+package existingvolumebroker
+
+import (
+	vmo "code.cloudfoundry.org/volume-mount-options"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+)
+
+const jsonSchemaVersion = "http://json-schema.org/draft-04/schema#"
+
+// withSchemas returns a copy of the catalog in which plans without schemas of
+// their own are given schemas generated from their config masks.
+func (b *Broker) withSchemas(services []domain.Service) []domain.Service {
+	result := []domain.Service{}
+	for _, service := range services {
+		plans := []domain.ServicePlan{}
+		for _, plan := range service.Plans {
+			if plan.Schemas == nil {
+				plan.Schemas = b.planSchemas(plan.ID)
+			}
+			plans = append(plans, plan)
+		}
+		service.Plans = plans
+		result = append(result, service)
+	}
+	return result
+}
+
+func (b *Broker) planSchemas(planID string) *domain.ServiceSchemas {
+	mask := b.configMaskFor(planID)
+
+	binding := parameterSchema(mask, b.DisallowedBindOverrides, nil, "Required, unless given when the service instance was created")
+	if !containsString(b.DisallowedBindOverrides, SUBPATH_KEY) {
+		binding.Parameters["properties"].(map[string]interface{})[SUBPATH_KEY] = map[string]interface{}{
+			"type":        "string",
+			"description": "A directory within the share to mount instead of the share itself",
+		}
+	}
+
+	return &domain.ServiceSchemas{
+		Instance: domain.ServiceInstanceSchema{
+			Create: parameterSchema(mask, []string{SOURCE_KEY}, []string{SHARE_KEY}, "Required, unless given when binding"),
+			Update: parameterSchema(mask, []string{SOURCE_KEY}, nil, "Required, unless given when binding"),
+		},
+		Binding: domain.ServiceBindingSchema{
+			Create: binding,
+		},
+	}
+}
+
+// parameterSchema describes the parameters the mask accepts, other than the
+// excluded ones. Values are given as strings, numbers or booleans, as the mask
+// turns them all into strings.
+func parameterSchema(mask vmo.MountOptsMask, excluded []string, required []string, mandatoryDescription string) domain.Schema {
+	canonicalKeys := map[string]string{}
+	for _, key := range append(append([]string{}, mask.Allowed...), mask.Ignored...) {
+		canonicalKeys[key] = key
+	}
+	for key, canonicalKey := range mask.KeyPerms {
+		if containsString(mask.Allowed, canonicalKey) || containsString(mask.Ignored, canonicalKey) {
+			canonicalKeys[key] = canonicalKey
+		}
+	}
+	canonicalKeys[SHARE_KEY] = SOURCE_KEY
+
+	properties := map[string]interface{}{}
+	for key, canonicalKey := range canonicalKeys {
+		if containsString(excluded, key) {
+			continue
+		}
+
+		property := map[string]interface{}{"type": []string{"string", "number", "boolean"}}
+		switch {
+		case key == SHARE_KEY:
+			property["type"] = "string"
+			property["description"] = "The existing share to mount"
+		case containsString(mask.Ignored, canonicalKey):
+			property["description"] = "Accepted, but ignored"
+		case canonicalKey != SOURCE_KEY && containsString(mask.Mandatory, canonicalKey):
+			property["description"] = mandatoryDescription
+		}
+		if value, ok := mask.Defaults[canonicalKey]; ok {
+			property["default"] = value
+		}
+		properties[key] = property
+	}
+
+	parameters := map[string]interface{}{
+		"$schema":              jsonSchemaVersion,
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": mask.SloppyMount,
+	}
+	if len(required) > 0 {
+		parameters["required"] = required
+	}
+
+	return domain.Schema{Parameters: parameters}
+}
@@ -0,0 +1,144 @@
+package existingvolumebroker_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/fakes"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	vmo "code.cloudfoundry.org/volume-mount-options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+)
+
+var _ = Describe("Schemas", func() {
+	var (
+		fakeServices *fakes.FakeServices
+		broker       *existingvolumebroker.Broker
+		customSchema *domain.ServiceSchemas
+	)
+
+	anyValue := []string{"string", "number", "boolean"}
+
+	BeforeEach(func() {
+		customSchema = &domain.ServiceSchemas{}
+		fakeServices = &fakes.FakeServices{}
+		fakeServices.ListReturns([]domain.Service{{
+			ID:   "smb-service-id",
+			Name: "smb",
+			Plans: []domain.ServicePlan{
+				{ID: "existing-plan-id", Name: "Existing"},
+				{ID: "pinned-plan-id", Name: "Pinned"},
+				{ID: "custom-plan-id", Name: "Custom", Schemas: customSchema},
+			},
+		}})
+
+		configMask, err := vmo.NewMountOptsMask(
+			[]string{"source", "mount", "ro", "username", "password", "vers"},
+			map[string]interface{}{"vers": "3.0"},
+			map[string]string{"share": "source", "readonly": "ro"},
+			[]string{"domain"},
+			[]string{"source", "username"},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		pinnedMask, err := vmo.NewMountOptsMask(
+			[]string{"source", "vers"},
+			map[string]interface{}{"sloppy_mount": "true"},
+			map[string]string{"share": "source"},
+			[]string{},
+			[]string{"source"},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		broker = existingvolumebroker.New(
+			existingvolumebroker.BrokerTypeSMB,
+			lagertest.NewTestLogger("test-broker"),
+			fakeServices,
+			&os_fake.FakeOs{},
+			nil,
+			localstore.NewMemoryStore(),
+			configMask,
+		)
+		broker.PlanConfigMasks = map[string]vmo.MountOptsMask{"pinned-plan-id": pinnedMask}
+	})
+
+	plan := func(index int) domain.ServicePlan {
+		services, err := broker.Services(context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		return services[0].Plans[index]
+	}
+
+	It("does not generate schemas unless asked to", func() {
+		Expect(plan(0).Schemas).To(BeNil())
+	})
+
+	Context("when schemas are generated", func() {
+		BeforeEach(func() {
+			broker.GenerateSchemas = true
+		})
+
+		It("describes the parameters of instances, requiring a share", func() {
+			parameters := plan(0).Schemas.Instance.Create.Parameters
+			Expect(parameters).To(Equal(map[string]interface{}{
+				"$schema": "http://json-schema.org/draft-04/schema#",
+				"type":    "object",
+				"properties": map[string]interface{}{
+					"share":    map[string]interface{}{"type": "string", "description": "The existing share to mount"},
+					"mount":    map[string]interface{}{"type": anyValue},
+					"ro":       map[string]interface{}{"type": anyValue},
+					"readonly": map[string]interface{}{"type": anyValue},
+					"username": map[string]interface{}{"type": anyValue, "description": "Required, unless given when binding"},
+					"password": map[string]interface{}{"type": anyValue},
+					"vers":     map[string]interface{}{"type": anyValue, "default": "3.0"},
+					"domain":   map[string]interface{}{"type": anyValue, "description": "Accepted, but ignored"},
+				},
+				"additionalProperties": false,
+				"required":             []string{"share"},
+			}))
+
+			Expect(plan(0).Schemas.Instance.Update.Parameters).NotTo(HaveKey("required"))
+			Expect(plan(0).Schemas.Instance.Update.Parameters["properties"]).To(HaveKey("share"))
+		})
+
+		It("leaves the options that cannot be overridden out of the binding parameters", func() {
+			properties := plan(0).Schemas.Binding.Create.Parameters["properties"]
+			Expect(properties).NotTo(HaveKey("share"))
+			Expect(properties).NotTo(HaveKey("source"))
+			Expect(properties).To(HaveKeyWithValue("username", map[string]interface{}{
+				"type":        anyValue,
+				"description": "Required, unless given when the service instance was created",
+			}))
+		})
+
+		It("generates the schemas of a plan from its own mask", func() {
+			parameters := plan(1).Schemas.Binding.Create.Parameters
+			Expect(parameters["properties"]).To(Equal(map[string]interface{}{
+				"vers": map[string]interface{}{"type": anyValue},
+				"subpath": map[string]interface{}{
+					"type":        "string",
+					"description": "A directory within the share to mount instead of the share itself",
+				},
+			}))
+			Expect(parameters["additionalProperties"]).To(BeTrue())
+		})
+
+		It("leaves the subpath out of the binding parameters when it cannot be given", func() {
+			broker.DisallowedBindOverrides = append(broker.DisallowedBindOverrides, "subpath")
+
+			Expect(plan(1).Schemas.Binding.Create.Parameters["properties"]).NotTo(HaveKey("subpath"))
+		})
+
+		It("keeps the schemas given in the catalog", func() {
+			Expect(plan(2).Schemas).To(BeIdenticalTo(customSchema))
+		})
+
+		It("does not modify the catalog", func() {
+			plan(0)
+			Expect(fakeServices.List()[0].Plans[0].Schemas).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,53 @@
+package existingvolumebroker
+
+import (
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+)
+
+// serviceKeyCredentials describes the share behind a binding to clients that
+// do not mount it through the platform. Secrets are left out of the mount
+// configuration.
+func (b *Broker) serviceKeyCredentials(instanceDetails brokerstore.ServiceInstance, bindDetails domain.BindDetails, volumeMount domain.VolumeMount) (map[string]interface{}, error) {
+	share, err := bindingShare(instanceDetails, bindDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	mountConfig := map[string]interface{}{}
+	for k, v := range volumeMount.Device.MountConfig {
+		if b.isSensitive(k) {
+			continue
+		}
+		mountConfig[k] = v
+	}
+
+	return map[string]interface{}{
+		SHARE_KEY:      share,
+		"driver":       volumeMount.Driver,
+		"mode":         volumeMount.Mode,
+		"mount_config": mountConfig,
+	}, nil
+}
+
+// bindingCredentials returns the credentials and volume mounts of a binding of
+// the given kind.
+func (b *Broker) bindingCredentials(kind bindingKind, instanceDetails brokerstore.ServiceInstance, bindDetails domain.BindDetails, volumeMount domain.VolumeMount) (interface{}, []domain.VolumeMount, error) {
+	var (
+		credentials map[string]interface{}
+		err         error
+	)
+	switch kind {
+	case appBinding:
+		// if nil, cloud controller chokes on response
+		return struct{}{}, []domain.VolumeMount{volumeMount}, nil
+	case kubernetesBinding:
+		credentials, err = b.kubernetesCredentials(instanceDetails, bindDetails, volumeMount)
+	default:
+		credentials, err = b.serviceKeyCredentials(instanceDetails, bindDetails, volumeMount)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return credentials, nil, nil
+}
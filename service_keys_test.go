@@ -0,0 +1,81 @@
+package existingvolumebroker_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+var _ = Describe("Service keys", func() {
+	var (
+		ctx    = context.TODO()
+		broker testBroker
+	)
+
+	BeforeEach(func() {
+		broker = provisionTestBroker(
+			existingvolumebroker.BrokerTypeSMB,
+			lagertest.NewTestLogger("test-broker"),
+			testConfigMask("source", "mount", "ro", "username", "password", "vers"),
+			localstore.NewMemoryStore(),
+			`{"share":"//server/share","vers":"3.0","username":"some-user","password":"some-password"}`,
+			"some-instance-id",
+		)
+	})
+
+	It("requires an app unless service keys are enabled", func() {
+		_, err := broker.bindApp("some-instance-id", "key-id", "", `{}`)
+		Expect(err).To(Equal(apiresponses.ErrAppGuidNotProvided))
+	})
+
+	Context("when service keys are enabled", func() {
+		BeforeEach(func() {
+			broker.ServiceKeys = true
+		})
+
+		It("returns the details of the share as credentials", func() {
+			binding, err := broker.bindApp("some-instance-id", "key-id", "", `{"readonly":true}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(binding.VolumeMounts).To(BeEmpty())
+			Expect(binding.Credentials).To(Equal(map[string]interface{}{
+				"share":  "//server/share",
+				"driver": "smbdriver",
+				"mode":   "r",
+				"mount_config": map[string]interface{}{
+					"source": "//server/share",
+					"vers":   "3.0",
+					"ro":     "true",
+				},
+			}))
+		})
+
+		It("returns the same credentials when the binding is fetched", func() {
+			binding, err := broker.bindApp("some-instance-id", "key-id", "", `{}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			fetched, err := broker.GetBinding(ctx, "some-instance-id", "key-id", domain.FetchBindingDetails{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fetched.Credentials).To(Equal(binding.Credentials))
+			Expect(fetched.VolumeMounts).To(BeEmpty())
+		})
+
+		It("validates the parameters like any binding", func() {
+			_, err := broker.bindApp("some-instance-id", "key-id", "", `{"uid":"1000"}`)
+			Expect(err).To(MatchError(ContainSubstring("Not allowed options: uid")))
+		})
+
+		It("still gives apps a volume mount", func() {
+			binding, err := broker.bindApp("some-instance-id", "binding-id", "guid", `{}`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(binding.VolumeMounts).To(HaveLen(1))
+			Expect(binding.Credentials).To(Equal(struct{}{}))
+		})
+	})
+})
@@ -0,0 +1,127 @@
+package existingvolumebroker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Share is a share broken down into its components by a Protocol.
+type Share struct {
+	Servers []Server
+	// Path is the absolute, cleaned path of the share on its servers.
+	Path string
+	// Canonical is the normalized form of the share. It is what the broker
+	// stores, so that different spellings of the same share bind to the same
+	// volume.
+	Canonical string
+}
+
+// Server is a server of a share. Port is zero unless the share names a port.
+type Server struct {
+	Host string
+	Port int
+}
+
+// String formats the server as it appears in a share, with IPv6 addresses in
+// brackets.
+func (s Server) String() string {
+	host := s.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if s.Port != 0 {
+		return fmt.Sprintf("%s:%d", host, s.Port)
+	}
+	return host
+}
+
+// hostname accepts underscores in labels as well, as NetBIOS names and some
+// internal DNS names use them.
+var hostname = regexp.MustCompile(`^[a-z0-9_]([a-z0-9_-]*[a-z0-9_])?(\.[a-z0-9_]([a-z0-9_-]*[a-z0-9_])?)*$`)
+
+func shareSyntaxError(format string, args ...interface{}) error {
+	return errors.New("syntax error for share: " + fmt.Sprintf(format, args...))
+}
+
+func rejectURL(share string) error {
+	if strings.Contains(share, "://") {
+		return shareSyntaxError("URLs are not supported")
+	}
+	return nil
+}
+
+// parseServer parses a host with an optional port. IPv6 addresses have to be
+// enclosed in brackets, and are normalized like host names are lowercased.
+func parseServer(server string, allowPort bool) (Server, error) {
+	if server == "" {
+		return Server{}, shareSyntaxError("missing server")
+	}
+
+	host, port := server, ""
+	if strings.HasPrefix(server, "[") {
+		end := strings.Index(server, "]")
+		if end < 0 {
+			return Server{}, shareSyntaxError("unterminated IPv6 address '%s'", server)
+		}
+		host, port = server[1:end], server[end+1:]
+		if port != "" && !strings.HasPrefix(port, ":") {
+			return Server{}, shareSyntaxError("unexpected '%s' after IPv6 address", port)
+		}
+		port = strings.TrimPrefix(port, ":")
+
+		ip := net.ParseIP(host)
+		if ip == nil || ip.To4() != nil {
+			return Server{}, shareSyntaxError("invalid IPv6 address '%s'", host)
+		}
+		host = ip.String()
+	} else {
+		switch strings.Count(server, ":") {
+		case 0:
+		case 1:
+			host, port, _ = strings.Cut(server, ":")
+		default:
+			return Server{}, shareSyntaxError("IPv6 address '%s' must be enclosed in brackets", server)
+		}
+
+		host = strings.ToLower(host)
+		if !hostname.MatchString(host) {
+			return Server{}, shareSyntaxError("invalid server '%s'", host)
+		}
+	}
+
+	parsed := Server{Host: host}
+	if port == "" && strings.HasSuffix(server, ":") {
+		return Server{}, shareSyntaxError("missing port after server '%s'", host)
+	}
+	if port != "" {
+		if !allowPort {
+			return Server{}, shareSyntaxError("port not allowed after server '%s'", host)
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil || p < 1 || p > 65535 {
+			return Server{}, shareSyntaxError("invalid port '%s'", port)
+		}
+		parsed.Port = p
+	}
+
+	return parsed, nil
+}
+
+// cleanPath cleans an absolute path, which removes trailing slashes.
+func cleanPath(p string) (string, error) {
+	for _, r := range p {
+		if unicode.IsControl(r) {
+			return "", shareSyntaxError("path contains control characters")
+		}
+	}
+	if !strings.HasPrefix(p, "/") {
+		return "", shareSyntaxError("path '%s' is not absolute", p)
+	}
+	return path.Clean(p), nil
+}
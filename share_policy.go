@@ -0,0 +1,288 @@
+package existingvolumebroker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+	"gopkg.in/yaml.v3"
+)
+
+// SharePolicy restricts the shares instances can be provisioned for. A share
+// is rejected when any of its servers matches a deny rule, or when allow rules
+// are given and one of its servers matches none of them.
+type SharePolicy struct {
+	Allow []ShareRule `json:"allow" yaml:"allow"`
+	Deny  []ShareRule `json:"deny" yaml:"deny"`
+}
+
+// ShareRule matches a server of a share when the server matches any of Hosts
+// and the path of the share is within any of PathPrefixes. An empty list
+// matches anything.
+//
+// Hosts are host names, wildcard domains such as "*.example.com", which match
+// any subdomain, IP addresses or CIDR ranges. Host names are not resolved, so
+// CIDR ranges only match shares that are given by IP address.
+type ShareRule struct {
+	Name         string   `json:"name" yaml:"name"`
+	Hosts        []string `json:"hosts" yaml:"hosts"`
+	PathPrefixes []string `json:"path_prefixes" yaml:"path_prefixes"`
+}
+
+// Validate reports rules that could never match as intended, so that policies
+// can be checked when they are loaded.
+func (p SharePolicy) Validate() error {
+	for _, rule := range append(append([]ShareRule{}, p.Allow...), p.Deny...) {
+		for _, host := range rule.Hosts {
+			if _, err := matchHost(host, Server{}); err != nil {
+				return fmt.Errorf("invalid share policy rule %s: %s", rule, err.Error())
+			}
+		}
+		for _, prefix := range rule.PathPrefixes {
+			if !strings.HasPrefix(prefix, "/") {
+				return fmt.Errorf("invalid share policy rule %s: path prefix '%s' is not absolute", rule, prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate returns an error naming the violated rule when the share is not
+// allowed by the policy.
+func (p SharePolicy) Evaluate(share Share) error {
+	for _, server := range share.Servers {
+		for _, rule := range p.Deny {
+			matched, err := rule.matches(server, share.Path)
+			if err != nil {
+				return err
+			}
+			if matched {
+				return fmt.Errorf("share '%s' is denied by rule %s", share.Canonical, rule)
+			}
+		}
+	}
+
+	if len(p.Allow) == 0 {
+		return nil
+	}
+
+	for _, server := range share.Servers {
+		allowed := false
+		for _, rule := range p.Allow {
+			matched, err := rule.matches(server, share.Path)
+			if err != nil {
+				return err
+			}
+			if matched {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("share '%s' on server '%s' is not allowed by any rule", share.Canonical, server)
+		}
+	}
+
+	return nil
+}
+
+// ScopedSharePolicies restrict the shares of instances in particular
+// organizations and spaces, keyed by their GUIDs. They apply in addition to
+// the global share policy, so a share must be allowed by all of them.
+type ScopedSharePolicies struct {
+	Organizations map[string]SharePolicy `json:"organizations" yaml:"organizations"`
+	Spaces        map[string]SharePolicy `json:"spaces" yaml:"spaces"`
+}
+
+// LoadScopedSharePolicies reads scoped share policies from a YAML (or JSON)
+// file and validates them.
+func LoadScopedSharePolicies(path string) (*ScopedSharePolicies, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := ScopedSharePolicies{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&policies); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse share policy file %s: %s", path, err.Error())
+	}
+
+	if err := policies.Validate(); err != nil {
+		return nil, err
+	}
+	return &policies, nil
+}
+
+func (p ScopedSharePolicies) Validate() error {
+	for _, scope := range p.scopes() {
+		if err := scope.policy.Validate(); err != nil {
+			return fmt.Errorf("%s for %s", err.Error(), scope.name)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns an error naming the organization or space and the rule
+// that the share violates.
+func (p ScopedSharePolicies) Evaluate(share Share, organizationGUID string, spaceGUID string) error {
+	if policy, ok := p.Organizations[organizationGUID]; ok && organizationGUID != "" {
+		if err := policy.Evaluate(share); err != nil {
+			return fmt.Errorf("%s for organization '%s'", err.Error(), organizationGUID)
+		}
+	}
+	if policy, ok := p.Spaces[spaceGUID]; ok && spaceGUID != "" {
+		if err := policy.Evaluate(share); err != nil {
+			return fmt.Errorf("%s for space '%s'", err.Error(), spaceGUID)
+		}
+	}
+	return nil
+}
+
+type sharePolicyScope struct {
+	name   string
+	policy SharePolicy
+}
+
+func (p ScopedSharePolicies) scopes() []sharePolicyScope {
+	scopes := []sharePolicyScope{}
+	for _, guid := range sortedKeys(p.Organizations) {
+		scopes = append(scopes, sharePolicyScope{fmt.Sprintf("organization '%s'", guid), p.Organizations[guid]})
+	}
+	for _, guid := range sortedKeys(p.Spaces) {
+		scopes = append(scopes, sharePolicyScope{fmt.Sprintf("space '%s'", guid), p.Spaces[guid]})
+	}
+	return scopes
+}
+
+func sortedKeys(policies map[string]SharePolicy) []string {
+	keys := []string{}
+	for k := range policies {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r ShareRule) String() string {
+	if r.Name != "" {
+		return fmt.Sprintf("'%s'", r.Name)
+	}
+	return fmt.Sprintf("{hosts: ['%s'], path_prefixes: ['%s']}", strings.Join(r.Hosts, "', '"), strings.Join(r.PathPrefixes, "', '"))
+}
+
+func (r ShareRule) matches(server Server, sharePath string) (bool, error) {
+	hostMatched := len(r.Hosts) == 0
+	for _, host := range r.Hosts {
+		matched, err := matchHost(host, server)
+		if err != nil {
+			return false, fmt.Errorf("invalid share policy rule %s: %s", r, err.Error())
+		}
+		if matched {
+			hostMatched = true
+			break
+		}
+	}
+	if !hostMatched {
+		return false, nil
+	}
+
+	if len(r.PathPrefixes) == 0 {
+		return true, nil
+	}
+	for _, prefix := range r.PathPrefixes {
+		if withinPath(sharePath, prefix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchHost(pattern string, server Server) (bool, error) {
+	ip := net.ParseIP(server.Host)
+
+	switch {
+	case strings.Contains(pattern, "/"):
+		_, network, err := net.ParseCIDR(pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid CIDR range '%s'", pattern)
+		}
+		return ip != nil && network.Contains(ip), nil
+	case strings.HasPrefix(pattern, "*."):
+		domain := strings.ToLower(pattern[1:])
+		if strings.Contains(domain, "*") {
+			return false, fmt.Errorf("invalid wildcard domain '%s'", pattern)
+		}
+		return ip == nil && strings.HasSuffix(server.Host, domain), nil
+	case strings.Contains(pattern, "*"):
+		return false, fmt.Errorf("invalid wildcard domain '%s'", pattern)
+	}
+
+	if patternIP := net.ParseIP(pattern); patternIP != nil {
+		return ip != nil && patternIP.Equal(ip), nil
+	}
+	return strings.EqualFold(pattern, server.Host), nil
+}
+
+// withinPath reports whether p is prefix or below it, comparing whole path
+// components.
+func withinPath(p string, prefix string) bool {
+	prefix = path.Clean(prefix)
+	if prefix == "/" || p == prefix {
+		return true
+	}
+	return strings.HasPrefix(p, prefix+"/")
+}
+
+// evaluateSharePolicy checks the share of an instance in the given
+// organization and space against the global and scoped share policies.
+func (b *Broker) evaluateSharePolicy(logger lager.Logger, share Share, organizationGUID string, spaceGUID string) error {
+	var err error
+	if b.SharePolicy != nil {
+		err = b.SharePolicy.Evaluate(share)
+	}
+	if err == nil && b.ScopedSharePolicies != nil {
+		err = b.ScopedSharePolicies.Evaluate(share, organizationGUID, spaceGUID)
+	}
+
+	if err != nil {
+		logger.Error("err-share-not-allowed", err, lager.Data{"organizationGUID": organizationGUID, "spaceGUID": spaceGUID})
+		return apiresponses.NewFailureResponse(err, http.StatusForbidden, "share-not-allowed")
+	}
+	return nil
+}
+
+// evaluateInstanceSharePolicy checks the share a binding mounts, the one its
+// instance was provisioned with or a directory within it, so that policies
+// tightened after provisioning also apply to new bindings and a subpath cannot
+// reach a denied directory.
+func (b *Broker) evaluateInstanceSharePolicy(logger lager.Logger, instanceDetails brokerstore.ServiceInstance, bindDetails domain.BindDetails) error {
+	if b.SharePolicy == nil && b.ScopedSharePolicies == nil {
+		return nil
+	}
+
+	bindShare, err := bindingShare(instanceDetails, bindDetails)
+	if err != nil {
+		return err
+	}
+
+	share, err := b.protocol.ParseShare(bindShare)
+	if err != nil {
+		err = fmt.Errorf("share of the service instance cannot be checked against the share policy: %s", err.Error())
+		logger.Error("err-share-not-allowed", err)
+		return apiresponses.NewFailureResponse(err, http.StatusForbidden, "share-not-allowed")
+	}
+
+	return b.evaluateSharePolicy(logger, share, instanceDetails.OrganizationGUID, instanceDetails.SpaceGUID)
+}
@@ -0,0 +1,324 @@
+package existingvolumebroker_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+var _ = Describe("SharePolicy", func() {
+	type rule = existingvolumebroker.ShareRule
+
+	parse := func(protocol existingvolumebroker.Protocol, share string) existingvolumebroker.Share {
+		parsed, err := protocol.ParseShare(share)
+		Expect(err).NotTo(HaveOccurred())
+		return parsed
+	}
+
+	DescribeTable("allows shares matching an allow rule",
+		func(allow rule, share string, allowed bool) {
+			policy := existingvolumebroker.SharePolicy{Allow: []rule{allow}}
+			err := policy.Evaluate(parse(existingvolumebroker.NFSProtocol{}, share))
+			if allowed {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring("is not allowed by any rule")))
+			}
+		},
+		Entry("by host name", rule{Hosts: []string{"Server.Example.com"}}, "server.example.com/export", true),
+		Entry("by a different host name", rule{Hosts: []string{"server.example.com"}}, "other.example.com/export", false),
+		Entry("by wildcard domain", rule{Hosts: []string{"*.example.com"}}, "nfs.storage.example.com/export", true),
+		Entry("by wildcard domain, excluding the domain itself", rule{Hosts: []string{"*.example.com"}}, "example.com/export", false),
+		Entry("by wildcard domain, excluding lookalike domains", rule{Hosts: []string{"*.example.com"}}, "server.badexample.com/export", false),
+		Entry("by CIDR range", rule{Hosts: []string{"10.0.0.0/8"}}, "10.1.2.3/export", true),
+		Entry("by CIDR range, outside the range", rule{Hosts: []string{"10.0.0.0/8"}}, "192.168.0.1/export", false),
+		Entry("by CIDR range, given a host name", rule{Hosts: []string{"10.0.0.0/8"}}, "server/export", false),
+		Entry("by IPv6 CIDR range", rule{Hosts: []string{"fd00::/8"}}, "[fd00::1]/export", true),
+		Entry("by IP address", rule{Hosts: []string{"fd00:0::1"}}, "[fd00::1]/export", true),
+		Entry("by path prefix", rule{PathPrefixes: []string{"/exports/team-a"}}, "server/exports/team-a/data", true),
+		Entry("by path prefix, matching the prefix itself", rule{PathPrefixes: []string{"/exports/team-a/"}}, "server/exports/team-a", true),
+		Entry("by path prefix, comparing whole components", rule{PathPrefixes: []string{"/exports/team-a"}}, "server/exports/team-ab", false),
+		Entry("by host and path prefix", rule{Hosts: []string{"server"}, PathPrefixes: []string{"/exports"}}, "other/exports", false),
+	)
+
+	It("allows any share when there are no rules", func() {
+		Expect(existingvolumebroker.SharePolicy{}.Evaluate(parse(existingvolumebroker.NFSProtocol{}, "server/export"))).To(Succeed())
+	})
+
+	It("denies shares matching a deny rule, even when they are allowed", func() {
+		policy := existingvolumebroker.SharePolicy{
+			Allow: []rule{{Hosts: []string{"*.example.com"}}},
+			Deny:  []rule{{Name: "no-scratch", PathPrefixes: []string{"/scratch"}}},
+		}
+
+		Expect(policy.Evaluate(parse(existingvolumebroker.NFSProtocol{}, "nfs.example.com/export"))).To(Succeed())
+		Expect(policy.Evaluate(parse(existingvolumebroker.NFSProtocol{}, "nfs.example.com/scratch/tmp"))).To(
+			MatchError("share 'nfs.example.com/scratch/tmp' is denied by rule 'no-scratch'"))
+	})
+
+	It("describes unnamed rules by their contents", func() {
+		policy := existingvolumebroker.SharePolicy{
+			Deny: []rule{{Hosts: []string{"10.0.0.0/8", "server"}, PathPrefixes: []string{"/scratch"}}},
+		}
+
+		Expect(policy.Evaluate(parse(existingvolumebroker.NFSProtocol{}, "server/scratch"))).To(
+			MatchError("share 'server/scratch' is denied by rule {hosts: ['10.0.0.0/8', 'server'], path_prefixes: ['/scratch']}"))
+	})
+
+	Context("given a share on several servers", func() {
+		var share existingvolumebroker.Share
+
+		BeforeEach(func() {
+			share = parse(existingvolumebroker.CephFSProtocol{}, "mon1.example.com,10.0.0.2:/subvolume")
+		})
+
+		It("requires every server to be allowed", func() {
+			policy := existingvolumebroker.SharePolicy{Allow: []rule{{Hosts: []string{"*.example.com"}}}}
+			Expect(policy.Evaluate(share)).To(MatchError("share 'mon1.example.com,10.0.0.2:/subvolume' on server '10.0.0.2' is not allowed by any rule"))
+
+			policy.Allow = append(policy.Allow, rule{Hosts: []string{"10.0.0.0/24"}})
+			Expect(policy.Evaluate(share)).To(Succeed())
+		})
+
+		It("denies the share when any server is denied", func() {
+			policy := existingvolumebroker.SharePolicy{Deny: []rule{{Name: "internal", Hosts: []string{"10.0.0.2"}}}}
+			Expect(policy.Evaluate(share)).To(MatchError("share 'mon1.example.com,10.0.0.2:/subvolume' is denied by rule 'internal'"))
+		})
+	})
+
+	DescribeTable("Validate",
+		func(policy existingvolumebroker.SharePolicy, message string) {
+			err := policy.Validate()
+			if message == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(message))
+			}
+		},
+		Entry("valid rules", existingvolumebroker.SharePolicy{
+			Allow: []rule{{Hosts: []string{"server", "*.example.com", "10.0.0.0/8", "fd00::1"}, PathPrefixes: []string{"/exports"}}},
+		}, ""),
+		Entry("an invalid CIDR range", existingvolumebroker.SharePolicy{
+			Allow: []rule{{Name: "lab", Hosts: []string{"10.0.0.0/33"}}},
+		}, "invalid share policy rule 'lab': invalid CIDR range '10.0.0.0/33'"),
+		Entry("a wildcard that is not a domain", existingvolumebroker.SharePolicy{
+			Deny: []rule{{Name: "everything", Hosts: []string{"server*"}}},
+		}, "invalid share policy rule 'everything': invalid wildcard domain 'server*'"),
+		Entry("a relative path prefix", existingvolumebroker.SharePolicy{
+			Deny: []rule{{Name: "scratch", PathPrefixes: []string{"scratch"}}},
+		}, "invalid share policy rule 'scratch': path prefix 'scratch' is not absolute"),
+	)
+
+	Context("when the broker has a share policy", func() {
+		var (
+			ctx    context.Context
+			broker *existingvolumebroker.Broker
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+
+			broker = newTestBroker(
+				existingvolumebroker.BrokerTypeNFS,
+				lagertest.NewTestLogger("test-broker"),
+				testConfigMask("source", "mount"),
+				localstore.NewMemoryStore(),
+			)
+			broker.SharePolicy = &existingvolumebroker.SharePolicy{
+				Allow: []rule{{Name: "exports", Hosts: []string{"*.example.com"}, PathPrefixes: []string{"/exports"}}},
+			}
+		})
+
+		It("provisions allowed shares", func() {
+			_, err := broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+				RawParameters: json.RawMessage(`{"share":"nfs.example.com/exports/data"}`),
+			}, false)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("refuses to provision other shares", func() {
+			_, err := broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+				RawParameters: json.RawMessage(`{"share":"nfs.example.com/home"}`),
+			}, false)
+			Expect(err).To(MatchError("share 'nfs.example.com/home' on server 'nfs.example.com' is not allowed by any rule"))
+			Expect(err).To(BeAssignableToTypeOf(&apiresponses.FailureResponse{}))
+			Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(403))
+		})
+
+		It("refuses to update an instance to another share", func() {
+			_, err := broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+				RawParameters: json.RawMessage(`{"share":"nfs.example.com/exports/data"}`),
+			}, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = broker.Update(ctx, "some-instance-id", domain.UpdateDetails{
+				RawParameters: json.RawMessage(`{"share":"10.0.0.1/exports/data"}`),
+			}, false)
+			Expect(err).To(MatchError("share '10.0.0.1/exports/data' on server '10.0.0.1' is not allowed by any rule"))
+			Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(403))
+		})
+	})
+
+	Context("ScopedSharePolicies", func() {
+		var policies existingvolumebroker.ScopedSharePolicies
+
+		BeforeEach(func() {
+			policies = existingvolumebroker.ScopedSharePolicies{
+				Organizations: map[string]existingvolumebroker.SharePolicy{
+					"org-a": {Allow: []rule{{Name: "team-a-filers", Hosts: []string{"*.team-a.example.com"}}}},
+				},
+				Spaces: map[string]existingvolumebroker.SharePolicy{
+					"space-a": {Allow: []rule{{Name: "space-a-exports", PathPrefixes: []string{"/exports/space-a"}}}},
+				},
+			}
+		})
+
+		It("applies the policies of the organization and space", func() {
+			share := parse(existingvolumebroker.NFSProtocol{}, "nfs.team-a.example.com/exports/space-a")
+			Expect(policies.Evaluate(share, "org-a", "space-a")).To(Succeed())
+
+			share = parse(existingvolumebroker.NFSProtocol{}, "nfs.team-b.example.com/exports/space-a")
+			Expect(policies.Evaluate(share, "org-a", "space-a")).To(MatchError(
+				"share 'nfs.team-b.example.com/exports/space-a' on server 'nfs.team-b.example.com' is not allowed by any rule for organization 'org-a'"))
+
+			share = parse(existingvolumebroker.NFSProtocol{}, "nfs.team-a.example.com/exports/space-b")
+			Expect(policies.Evaluate(share, "org-a", "space-a")).To(MatchError(
+				"share 'nfs.team-a.example.com/exports/space-b' on server 'nfs.team-a.example.com' is not allowed by any rule for space 'space-a'"))
+		})
+
+		It("does not restrict other organizations and spaces", func() {
+			share := parse(existingvolumebroker.NFSProtocol{}, "nfs.team-b.example.com/exports/space-b")
+			Expect(policies.Evaluate(share, "org-b", "space-b")).To(Succeed())
+			Expect(policies.Evaluate(share, "", "")).To(Succeed())
+		})
+
+		It("names the scope of invalid rules", func() {
+			policies.Spaces["space-b"] = existingvolumebroker.SharePolicy{Deny: []rule{{Name: "bad", Hosts: []string{"10.0.0.0/99"}}}}
+			Expect(policies.Validate()).To(MatchError("invalid share policy rule 'bad': invalid CIDR range '10.0.0.0/99' for space 'space-b'"))
+		})
+
+		Context("LoadScopedSharePolicies", func() {
+			var path string
+
+			BeforeEach(func() {
+				path = filepath.Join(GinkgoT().TempDir(), "share-policies.yml")
+			})
+
+			It("loads policies from a YAML file", func() {
+				Expect(os.WriteFile(path, []byte(`
+organizations:
+  org-a:
+    allow:
+    - name: team-a-filers
+      hosts: ["*.team-a.example.com"]
+spaces:
+  space-a:
+    deny:
+    - name: no-scratch
+      path_prefixes: [/scratch]
+`), 0600)).To(Succeed())
+
+				loaded, err := existingvolumebroker.LoadScopedSharePolicies(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*loaded).To(Equal(existingvolumebroker.ScopedSharePolicies{
+					Organizations: map[string]existingvolumebroker.SharePolicy{
+						"org-a": {Allow: []rule{{Name: "team-a-filers", Hosts: []string{"*.team-a.example.com"}}}},
+					},
+					Spaces: map[string]existingvolumebroker.SharePolicy{
+						"space-a": {Deny: []rule{{Name: "no-scratch", PathPrefixes: []string{"/scratch"}}}},
+					},
+				}))
+			})
+
+			It("loads an empty file", func() {
+				Expect(os.WriteFile(path, nil, 0600)).To(Succeed())
+
+				loaded, err := existingvolumebroker.LoadScopedSharePolicies(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*loaded).To(Equal(existingvolumebroker.ScopedSharePolicies{}))
+			})
+
+			It("rejects unknown keys", func() {
+				Expect(os.WriteFile(path, []byte("orgs: {}\n"), 0600)).To(Succeed())
+
+				_, err := existingvolumebroker.LoadScopedSharePolicies(path)
+				Expect(err).To(MatchError(ContainSubstring("failed to parse share policy file " + path)))
+			})
+
+			It("rejects invalid rules", func() {
+				Expect(os.WriteFile(path, []byte("spaces: {space-a: {allow: [{name: relative, path_prefixes: [exports]}]}}\n"), 0600)).To(Succeed())
+
+				_, err := existingvolumebroker.LoadScopedSharePolicies(path)
+				Expect(err).To(MatchError("invalid share policy rule 'relative': path prefix 'exports' is not absolute for space 'space-a'"))
+			})
+		})
+	})
+
+	Context("when the broker has scoped share policies", func() {
+		var (
+			ctx    context.Context
+			broker *existingvolumebroker.Broker
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+
+			broker = newTestBroker(
+				existingvolumebroker.BrokerTypeNFS,
+				lagertest.NewTestLogger("test-broker"),
+				testConfigMask("source", "mount"),
+				localstore.NewMemoryStore(),
+			)
+			broker.ScopedSharePolicies = &existingvolumebroker.ScopedSharePolicies{
+				Spaces: map[string]existingvolumebroker.SharePolicy{
+					"space-a": {Deny: []rule{{Name: "no-scratch", PathPrefixes: []string{"/scratch"}}}},
+				},
+			}
+		})
+
+		provision := func(share string, spaceGUID string) error {
+			_, err := broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+				OrganizationGUID: "org-a",
+				SpaceGUID:        spaceGUID,
+				RawParameters:    json.RawMessage(`{"share":"` + share + `"}`),
+			}, false)
+			return err
+		}
+
+		It("refuses to provision shares the space may not use", func() {
+			err := provision("server/scratch/tmp", "space-a")
+			Expect(err).To(MatchError("share 'server/scratch/tmp' is denied by rule 'no-scratch' for space 'space-a'"))
+			Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(403))
+
+			Expect(provision("server/scratch/tmp", "space-b")).To(Succeed())
+		})
+
+		It("refuses to update an instance to a share its space may not use", func() {
+			Expect(provision("server/exports", "space-a")).To(Succeed())
+
+			broker.ImmutableUpdateKeys = []string{}
+			_, err := broker.Update(ctx, "some-instance-id", domain.UpdateDetails{
+				RawParameters: json.RawMessage(`{"share":"server/scratch"}`),
+			}, false)
+			Expect(err).To(MatchError("share 'server/scratch' is denied by rule 'no-scratch' for space 'space-a'"))
+		})
+
+		It("refuses to bind instances whose share the space may no longer use", func() {
+			Expect(provision("server/scratch", "space-b")).To(Succeed())
+			broker.ScopedSharePolicies.Spaces["space-b"] = broker.ScopedSharePolicies.Spaces["space-a"]
+
+			_, err := broker.Bind(ctx, "some-instance-id", "binding-id", domain.BindDetails{AppGUID: "guid"}, false)
+			Expect(err).To(MatchError("share 'server/scratch' is denied by rule 'no-scratch' for space 'space-b'"))
+			Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(403))
+		})
+	})
+})
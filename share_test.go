@@ -0,0 +1,197 @@
+package existingvolumebroker_test
+
+import (
+	"context"
+	"encoding/json"
+
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/fakes"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	vmo "code.cloudfoundry.org/volume-mount-options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+)
+
+var _ = Describe("Share parsing", func() {
+	type server = existingvolumebroker.Server
+
+	DescribeTable("parses and normalizes shares",
+		func(protocol existingvolumebroker.Protocol, share string, servers []server, path string, canonical string) {
+			parsed, err := protocol.ParseShare(share)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Servers).To(Equal(servers))
+			Expect(parsed.Path).To(Equal(path))
+			Expect(parsed.Canonical).To(Equal(canonical))
+		},
+		Entry("NFS", existingvolumebroker.NFSProtocol{}, "server/export", []server{{Host: "server"}}, "/export", "server/export"),
+		Entry("NFS with a port", existingvolumebroker.NFSProtocol{}, "server:2049/export", []server{{Host: "server", Port: 2049}}, "/export", "server:2049/export"),
+		Entry("NFS with a trailing slash", existingvolumebroker.NFSProtocol{}, "Server.Example.com/export//dir/", []server{{Host: "server.example.com"}}, "/export/dir", "server.example.com/export/dir"),
+		Entry("NFS with a colon in the path", existingvolumebroker.NFSProtocol{}, "server/some-share:dir/", []server{{Host: "server"}}, "/some-share:dir", "server/some-share:dir"),
+		Entry("NFS with an underscore in the server", existingvolumebroker.NFSProtocol{}, "nfs_01.corp/export", []server{{Host: "nfs_01.corp"}}, "/export", "nfs_01.corp/export"),
+		Entry("NFS over IPv6", existingvolumebroker.NFSProtocol{}, "[FD00:0:0::1]/export", []server{{Host: "fd00::1"}}, "/export", "[fd00::1]/export"),
+		Entry("NFSv4", existingvolumebroker.NFSv4Protocol{}, "server:/export/", []server{{Host: "server"}}, "/export", "server:/export"),
+		Entry("NFSv4 without a colon", existingvolumebroker.NFSv4Protocol{}, "server/export", []server{{Host: "server"}}, "/export", "server:/export"),
+		Entry("NFSv4 root", existingvolumebroker.NFSv4Protocol{}, "server:/", []server{{Host: "server"}}, "/", "server:/"),
+		Entry("NFSv4 over IPv6", existingvolumebroker.NFSv4Protocol{}, "[fd00::1]:/export", []server{{Host: "fd00::1"}}, "/export", "[fd00::1]:/export"),
+		Entry("SMB", existingvolumebroker.SMBProtocol{}, "//server/share", []server{{Host: "server"}}, "/share", "//server/share"),
+		Entry("SMB with backslashes", existingvolumebroker.SMBProtocol{}, `\\SERVER\share\dir\`, []server{{Host: "server"}}, "/share/dir", "//server/share/dir"),
+		Entry("SMB without leading slashes", existingvolumebroker.SMBProtocol{}, "server/share", []server{{Host: "server"}}, "/share", "//server/share"),
+		Entry("SMB with a NetBIOS name", existingvolumebroker.SMBProtocol{}, "//FILE_SRV/share", []server{{Host: "file_srv"}}, "/share", "//file_srv/share"),
+		Entry("SMB over IPv6", existingvolumebroker.SMBProtocol{}, "//[fd00::1]/share", []server{{Host: "fd00::1"}}, "/share", "//[fd00::1]/share"),
+		Entry("CephFS", existingvolumebroker.CephFSProtocol{}, "mon1:/volumes/group/subvolume/", []server{{Host: "mon1"}}, "/volumes/group/subvolume", "mon1:/volumes/group/subvolume"),
+		Entry("CephFS with several monitors", existingvolumebroker.CephFSProtocol{}, "MON1:6789,10.0.0.2,[fd00::3]:3300:/subvolume",
+			[]server{{Host: "mon1", Port: 6789}, {Host: "10.0.0.2"}, {Host: "fd00::3", Port: 3300}}, "/subvolume", "mon1:6789,10.0.0.2,[fd00::3]:3300:/subvolume"),
+	)
+
+	DescribeTable("rejects malformed shares",
+		func(protocol existingvolumebroker.Protocol, share string, message string) {
+			_, err := protocol.ParseShare(share)
+			Expect(err).To(MatchError(message))
+		},
+		Entry("NFS with a colon after the server", existingvolumebroker.NFSProtocol{}, "server:/export", "syntax error for share: no colon allowed after server"),
+		Entry("NFS without a path", existingvolumebroker.NFSProtocol{}, "server", "syntax error for share: missing path after server"),
+		Entry("NFS without a server", existingvolumebroker.NFSProtocol{}, "/export", "syntax error for share: missing server"),
+		Entry("NFS with an invalid port", existingvolumebroker.NFSProtocol{}, "server:99999/export", "syntax error for share: invalid port '99999'"),
+		Entry("NFS with an invalid server", existingvolumebroker.NFSProtocol{}, "ser$ver/export", "syntax error for share: invalid server 'ser$ver'"),
+		Entry("NFS with an unbracketed IPv6 address", existingvolumebroker.NFSProtocol{}, "fd00::1/export", "syntax error for share: IPv6 address 'fd00::1' must be enclosed in brackets"),
+		Entry("NFS with an invalid IPv6 address", existingvolumebroker.NFSProtocol{}, "[fd00::g]/export", "syntax error for share: invalid IPv6 address 'fd00::g'"),
+		Entry("NFS with control characters", existingvolumebroker.NFSProtocol{}, "server/exp\nort", "syntax error for share: path contains control characters"),
+		Entry("NFSv4 URL", existingvolumebroker.NFSv4Protocol{}, "nfs://server/export", "syntax error for share: URLs are not supported"),
+		Entry("NFSv4 with a port", existingvolumebroker.NFSv4Protocol{}, "server:2049:/export", "syntax error for share: port not allowed after server 'server'"),
+		Entry("NFSv4 with an unterminated IPv6 address", existingvolumebroker.NFSv4Protocol{}, "[fd00::1:/export", "syntax error for share: unterminated IPv6 address '[fd00::1:/export'"),
+		Entry("SMB without a share name", existingvolumebroker.SMBProtocol{}, "//server/", "syntax error for share: missing share name after server 'server'"),
+		Entry("SMB with a single leading slash", existingvolumebroker.SMBProtocol{}, "/server/share", "syntax error for share: expected //server/share"),
+		Entry("SMB with a port", existingvolumebroker.SMBProtocol{}, "//server:445/share", "syntax error for share: port not allowed after server 'server'"),
+		Entry("SMB URL", existingvolumebroker.SMBProtocol{}, "smb://server/share", "syntax error for share: URLs are not supported"),
+		Entry("CephFS without a path", existingvolumebroker.CephFSProtocol{}, "mon1:6789", "syntax error for share: missing path after monitors, expected monitor[:port][,monitor[:port]...]:/path"),
+		Entry("CephFS with an empty monitor", existingvolumebroker.CephFSProtocol{}, "mon1,,mon2:/subvolume", "syntax error for share: missing server"),
+		Entry("CephFS with a missing port", existingvolumebroker.CephFSProtocol{}, "mon1::/subvolume", "syntax error for share: missing port after server 'mon1'"),
+	)
+
+	Context("when provisioning", func() {
+		var (
+			ctx    context.Context
+			store  *localstore.MemoryStore
+			broker *existingvolumebroker.Broker
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			store = localstore.NewMemoryStore()
+
+			configMask, err := vmo.NewMountOptsMask(
+				[]string{"source", "mount", "uid"},
+				map[string]interface{}{},
+				map[string]string{"share": "source"},
+				[]string{},
+				[]string{"source"},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			broker = existingvolumebroker.New(
+				existingvolumebroker.BrokerTypeSMB,
+				lagertest.NewTestLogger("test-broker"),
+				&fakes.FakeServices{},
+				&os_fake.FakeOs{},
+				nil,
+				store,
+				configMask,
+			)
+
+			_, err = broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+				RawParameters: json.RawMessage(`{"share":"\\\\Server\\share\\"}`),
+			}, false)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("stores the canonical form of the share", func() {
+			instance, err := store.RetrieveInstanceDetails("some-instance-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instance.ServiceFingerPrint).To(Equal(map[string]interface{}{"share": "//server/share"}))
+		})
+
+		It("does not conflict with a different spelling of the same share", func() {
+			_, err := broker.Provision(ctx, "some-instance-id", domain.ProvisionDetails{
+				RawParameters: json.RawMessage(`{"share":"//server/share"}`),
+			}, false)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("binds different spellings of the same share to the same volume", func() {
+			_, err := broker.Provision(ctx, "other-instance-id", domain.ProvisionDetails{
+				RawParameters: json.RawMessage(`{"share":"server/share/"}`),
+			}, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			binding, err := broker.Bind(ctx, "some-instance-id", "binding-id", domain.BindDetails{AppGUID: "guid"}, false)
+			Expect(err).NotTo(HaveOccurred())
+			otherBinding, err := broker.Bind(ctx, "other-instance-id", "other-binding-id", domain.BindDetails{AppGUID: "guid"}, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(otherBinding.VolumeMounts[0].Device.MountConfig).To(Equal(binding.VolumeMounts[0].Device.MountConfig))
+		})
+
+		It("accepts a different spelling of the share on update", func() {
+			_, err := broker.Update(ctx, "some-instance-id", domain.UpdateDetails{
+				RawParameters: json.RawMessage(`{"share":"//SERVER/share","uid":"1000"}`),
+			}, false)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("compares the share of instances stored before shares were normalized by its canonical form", func() {
+			Expect(store.CreateInstanceDetails("legacy-instance-id", brokerstore.ServiceInstance{
+				ServiceFingerPrint: map[string]interface{}{"share": `\\server\share`},
+			})).To(Succeed())
+
+			_, err := broker.Update(ctx, "legacy-instance-id", domain.UpdateDetails{
+				RawParameters: json.RawMessage(`{"share":"//server/share"}`),
+			}, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = broker.Update(ctx, "legacy-instance-id", domain.UpdateDetails{
+				RawParameters: json.RawMessage(`{"share":"//server/other-share"}`),
+			}, false)
+			Expect(err).To(MatchError("update configuration cannot change the following option: ['share']"))
+		})
+
+		Context("when an instance was stored before shares were normalized", func() {
+			var binding domain.Binding
+
+			BeforeEach(func() {
+				Expect(store.CreateInstanceDetails("legacy-instance-id", brokerstore.ServiceInstance{
+					ServiceFingerPrint: map[string]interface{}{"share": `\\Server\share\`},
+				})).To(Succeed())
+
+				var err error
+				binding, err = broker.Bind(ctx, "legacy-instance-id", "binding-id", domain.BindDetails{AppGUID: "guid"}, false)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("accepts an identical provision of the same share", func() {
+				_, err := broker.Provision(ctx, "legacy-instance-id", domain.ProvisionDetails{
+					RawParameters: json.RawMessage(`{"share":"//server/share"}`),
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("keeps the spelling of the share, and so its volume IDs, on update", func() {
+				_, err := broker.Update(ctx, "legacy-instance-id", domain.UpdateDetails{
+					RawParameters: json.RawMessage(`{"share":"//server/share"}`),
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				instance, err := store.RetrieveInstanceDetails("legacy-instance-id")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(instance.ServiceFingerPrint).To(HaveKeyWithValue("share", `\\Server\share\`))
+
+				otherBinding, err := broker.Bind(ctx, "legacy-instance-id", "other-binding-id", domain.BindDetails{AppGUID: "other-guid"}, false)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(otherBinding.VolumeMounts[0].Device.VolumeId).To(Equal(binding.VolumeMounts[0].Device.VolumeId))
+			})
+		})
+	})
+})
@@ -0,0 +1,53 @@
+package existingvolumebroker
+
+import "strings"
+
+// SMBProtocol binds SMB shares, given as "//server/share[/path]", to the
+// smbdriver. Shares may also be given with backslashes, or without the
+// leading slashes.
+type SMBProtocol struct{}
+
+func (SMBProtocol) ParseShare(share string) (Share, error) {
+	if err := rejectURL(share); err != nil {
+		return Share{}, err
+	}
+
+	unc := strings.ReplaceAll(share, `\`, "/")
+	if strings.HasPrefix(unc, "//") {
+		unc = strings.TrimPrefix(unc, "//")
+	} else if strings.HasPrefix(unc, "/") {
+		return Share{}, shareSyntaxError("expected //server/share")
+	}
+
+	server, sharePath, _ := strings.Cut(unc, "/")
+	parsedServer, err := parseServer(server, false)
+	if err != nil {
+		return Share{}, err
+	}
+
+	cleanedPath, err := cleanPath("/" + sharePath)
+	if err != nil {
+		return Share{}, err
+	}
+	if cleanedPath == "/" {
+		return Share{}, shareSyntaxError("missing share name after server '%s'", parsedServer.Host)
+	}
+
+	return Share{
+		Servers:   []Server{parsedServer},
+		Path:      cleanedPath,
+		Canonical: "//" + parsedServer.String() + cleanedPath,
+	}, nil
+}
+
+func (SMBProtocol) Source(share string) string {
+	return share
+}
+
+func (SMBProtocol) DriverName() string {
+	return "smbdriver"
+}
+
+func (SMBProtocol) MountConfig(mountOpts map[string]interface{}) (map[string]interface{}, error) {
+	return mountOpts, nil
+}
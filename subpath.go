@@ -0,0 +1,84 @@
+package existingvolumebroker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"github.com/pivotal-cf/brokerapi/v10/domain"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+// validateSubpath returns the cleaned form of a subpath bind parameter, a
+// directory within the share relative to its root, or an error when it would
+// climb out of the share.
+func validateSubpath(value interface{}) (string, error) {
+	subpath, ok := value.(string)
+	if !ok {
+		return "", invalidSubpath(fmt.Errorf("subpath must be a string"))
+	}
+
+	for _, r := range subpath {
+		if unicode.IsControl(r) {
+			return "", invalidSubpath(fmt.Errorf("subpath '%s' must not contain control characters", subpath))
+		}
+	}
+	// SMB shares also separate directories with backslashes
+	for _, component := range strings.FieldsFunc(subpath, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if component == ".." {
+			return "", invalidSubpath(fmt.Errorf("subpath '%s' must not contain '..'", subpath))
+		}
+	}
+
+	cleaned := strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(subpath, `\`, "/")), "/")
+	if cleaned == "" {
+		return "", invalidSubpath(fmt.Errorf("subpath '%s' does not name a directory within the share", subpath))
+	}
+
+	return cleaned, nil
+}
+
+func invalidSubpath(err error) error {
+	return apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-subpath")
+}
+
+// joinSubpath appends a subpath to a share, separating it the way the share
+// separates its own path.
+func joinSubpath(share string, subpath string) string {
+	if strings.Contains(share, `\`) && !strings.Contains(share, "/") {
+		return strings.TrimRight(share, `\`) + `\` + strings.ReplaceAll(subpath, "/", `\`)
+	}
+	return strings.TrimRight(share, "/") + "/" + subpath
+}
+
+// bindingShare returns the share a binding mounts, which is the share of its
+// service instance or, given the subpath parameter, a directory within it.
+func bindingShare(instanceDetails brokerstore.ServiceInstance, bindDetails domain.BindDetails) (string, error) {
+	fingerprint, err := getFingerprint(instanceDetails.ServiceFingerPrint)
+	if err != nil {
+		return "", err
+	}
+	share := stringifyShare(fingerprint[SHARE_KEY])
+
+	var bindOpts map[string]interface{}
+	if len(bindDetails.RawParameters) > 0 {
+		if err := json.Unmarshal(bindDetails.RawParameters, &bindOpts); err != nil {
+			return "", err
+		}
+	}
+
+	value, ok := bindOpts[SUBPATH_KEY]
+	if !ok {
+		return share, nil
+	}
+
+	subpath, err := validateSubpath(value)
+	if err != nil {
+		return "", err
+	}
+	return joinSubpath(share, subpath), nil
+}
@@ -0,0 +1,129 @@
+package existingvolumebroker_test
+
+import (
+	"encoding/json"
+
+	"code.cloudfoundry.org/existingvolumebroker"
+	"code.cloudfoundry.org/existingvolumebroker/localstore"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v10/domain/apiresponses"
+)
+
+var _ = Describe("Subpaths", func() {
+	var broker testBroker
+
+	Context("for NFS", func() {
+		BeforeEach(func() {
+			broker = provisionTestBroker(
+				existingvolumebroker.BrokerTypeNFS,
+				lagertest.NewTestLogger("test-broker"),
+				testConfigMask("source", "mount"),
+				localstore.NewMemoryStore(),
+				`{"share":"server/export"}`,
+				"some-instance-id",
+			)
+		})
+
+		It("mounts the directory within the share", func() {
+			binding, err := broker.bindApp("some-instance-id", "binding-id", "guid", `{"subpath":"team-a//apps/"}`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(binding.VolumeMounts[0].Device.MountConfig["source"]).To(Equal("nfs://server/export/team-a/apps"))
+		})
+
+		It("gives each subpath its own volume", func() {
+			binding, err := broker.bindApp("some-instance-id", "binding-id", "guid", `{}`)
+			Expect(err).NotTo(HaveOccurred())
+			subpathBinding, err := broker.bindApp("some-instance-id", "other-binding-id", "other-guid", `{"subpath":"team-a"}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			volumeID := subpathBinding.VolumeMounts[0].Device.VolumeId
+			Expect(volumeID).To(HavePrefix("some-instance-id-"))
+			Expect(volumeID).NotTo(Equal(binding.VolumeMounts[0].Device.VolumeId))
+		})
+
+		DescribeTable("rejects invalid subpaths",
+			func(params string, message string) {
+				_, err := broker.bindApp("some-instance-id", "binding-id", "guid", params)
+				Expect(err).To(MatchError(message))
+				Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+			},
+			Entry("a path climbing up", `{"subpath":"team-a/../../etc"}`, "subpath 'team-a/../../etc' must not contain '..'"),
+			Entry("a path climbing up with backslashes", `{"subpath":"team-a\\..\\.."}`, `subpath 'team-a\..\..' must not contain '..'`),
+			Entry("the root of the share", `{"subpath":"/./"}`, "subpath '/./' does not name a directory within the share"),
+			Entry("a path with control characters", `{"subpath":"team-a\n"}`, "subpath 'team-a\n' must not contain control characters"),
+			Entry("a path that is not a string", `{"subpath":42}`, "subpath must be a string"),
+		)
+
+		It("still does not allow the share to be overridden", func() {
+			_, err := broker.bindApp("some-instance-id", "binding-id", "guid", `{"subpath":"team-a","share":"other-server/export"}`)
+			Expect(err).To(MatchError("bind configuration contains the following invalid option: ['share']"))
+		})
+
+		It("can be disallowed like other bind parameters", func() {
+			broker.DisallowedBindOverrides = append(broker.DisallowedBindOverrides, "subpath")
+
+			_, err := broker.bindApp("some-instance-id", "binding-id", "guid", `{"subpath":"team-a"}`)
+			Expect(err).To(MatchError("bind configuration contains the following invalid option: ['subpath']"))
+			Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(400))
+		})
+
+		It("gives the directory as the share of service keys", func() {
+			broker.ServiceKeys = true
+
+			binding, err := broker.bindApp("some-instance-id", "binding-id", "", `{"subpath":"team-a"}`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(binding.Credentials).To(HaveKeyWithValue("share", "server/export/team-a"))
+		})
+
+		It("gives the directory as the path of Kubernetes persistent volumes", func() {
+			binding, err := broker.bindKubernetes("some-instance-id", "binding-id", `{"subpath":"team-a"}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			credentials, err := json.Marshal(binding.Credentials)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(credentials)).To(ContainSubstring(`"path":"/export/team-a"`))
+		})
+
+		It("checks the directory against the share policy", func() {
+			broker.SharePolicy = &existingvolumebroker.SharePolicy{
+				Deny: []existingvolumebroker.ShareRule{{PathPrefixes: []string{"/export/secret"}}},
+			}
+
+			_, err := broker.bindApp("some-instance-id", "binding-id", "guid", `{"subpath":"team-a"}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = broker.bindApp("some-instance-id", "other-binding-id", "other-guid", `{"subpath":"secret/keys"}`)
+			Expect(err).To(MatchError(ContainSubstring("share 'server/export/secret/keys' is denied")))
+			Expect(err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil)).To(Equal(403))
+		})
+	})
+
+	Context("for SMB", func() {
+		BeforeEach(func() {
+			broker = provisionTestBroker(
+				existingvolumebroker.BrokerTypeSMB,
+				lagertest.NewTestLogger("test-broker"),
+				testConfigMask("source", "mount"),
+				localstore.NewMemoryStore(),
+				`{"share":"//server/share"}`,
+				"some-instance-id",
+			)
+		})
+
+		It("appends the subpath to the UNC path", func() {
+			binding, err := broker.bindApp("some-instance-id", "binding-id", "guid", `{"subpath":"team-a/apps"}`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(binding.VolumeMounts[0].Device.MountConfig["source"]).To(Equal("//server/share/team-a/apps"))
+		})
+
+		It("appends the subpath to shares given with backslashes", func() {
+			broker.provision("backslash-instance-id", `{"share":"\\\\server\\share"}`)
+
+			binding, err := broker.bindApp("backslash-instance-id", "binding-id", "guid", `{"subpath":"team-a\\apps"}`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(binding.VolumeMounts[0].Device.MountConfig["source"]).To(Equal("//server/share/team-a/apps"))
+		})
+	})
+})